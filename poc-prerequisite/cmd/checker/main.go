@@ -3,51 +3,416 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
 
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/checks"
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/checks/ebpf"
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/checks/network"
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/checks/nodecompat"
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/checks/permissions"
 	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/checks/pvcheck"
-	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/checks/sizing"
 	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
 )
 
 func main() {
 	// Define and parse our flag for active checks
 	activeChecks := flag.Bool("active-checks", false, "If set, run checks that require resource deployment on the cluster.")
+	checksFlag := flag.String("checks", "", "Comma-separated check names or tags (e.g. active, storage, network) to run. Default: all checks.")
+	skipChecksFlag := flag.String("skip-checks", "", "Comma-separated check names or tags to skip.")
+	minKernelVersion := flag.String("min-kernel-version", nodecompat.DefaultMinKernelVersion, "Oldest node kernel version (major.minor) accepted by the node-compatibility check.")
+	helmNamespace := flag.String("helm-namespace", permissions.DefaultNamespace, "Namespace the kubescape-operator chart will be installed into, for the helm-permissions check.")
+
+	// Cluster access
+	kubeconfig := flag.String("kubeconfig", "", "Path to the kubeconfig file. Default: $KUBECONFIG, then ~/.kube/config (in-cluster config when running in a pod).")
+	kubeContext := flag.String("context", "", "Kubeconfig context to use instead of the current-context.")
+	asUser := flag.String("as", "", "User to impersonate for all cluster operations.")
+	asGroups := flag.String("as-group", "", "Comma-separated groups to impersonate, together with --as.")
+
+	// Offline replay
+	fromDump := flag.String("from-dump", "", "Regenerate the report from a full-cluster-dump.yaml or a `kubectl get -A -o yaml` export instead of a live cluster (passive checks and sizing only).")
+
+	// Multi-cluster run
+	contextsFlag := flag.String("contexts", "", "Comma-separated kubeconfig contexts to check one after another, with a summary comparing them.")
+	allContexts := flag.Bool("all-contexts", false, "Check every context of the kubeconfig, with a summary comparing them.")
+	parallelClusters := flag.Int("parallel-clusters", defaultParallelClusters, "Number of clusters checked concurrently in a multi-cluster run.")
+	clusterTimeout := flag.Duration("cluster-timeout", defaultClusterTimeout, "Time budget of a single cluster in a multi-cluster run.")
+
+	// HTTP server
+	serveAddr := flag.String("serve", "", "Serve the latest report, JSON, values and dump over HTTP on this address, e.g. 127.0.0.1:8080 (reachable with kubectl port-forward), and keep running.")
+
+	// Continuous mode
+	watch := flag.Bool("watch", false, "Keep running: re-evaluate sizing and the passive checks when nodes or workloads change, and every --watch-interval.")
+	watchInterval := flag.Duration("watch-interval", defaultWatchInterval, "Interval of the re-evaluations in --watch mode.")
+	watchDebounce := flag.Duration("watch-debounce", defaultWatchDebounce, "Delay between a change and its re-evaluation in --watch mode, so that a rollout is evaluated once.")
+	driftThreshold := flag.Float64("sizing-drift-threshold", defaultSizingDriftThreshold, "Change of a sizing input, in percent, that emits a SizingDrift Event in --watch mode.")
+
+	// Cluster data collection
+	pageSize := flag.Int64("page-size", common.DefaultPageSize, "Number of objects requested per List call while collecting cluster data.")
+	collectWorkers := flag.Int("collect-workers", common.DefaultWorkers, "Number of resource kinds listed concurrently.")
+	collectTimeout := flag.Duration("collect-timeout", common.DefaultCallTimeout, "Timeout of every single List call.")
+	outputDir := flag.String("output-dir", "", "Directory the report files are written to (default: the temp directory). In a pod, files are written here instead of the ConfigMap.")
+	runSubdir := flag.Bool("run-subdir", true, "Write every run into its own <timestamp>-<cluster> subdirectory of the output directory.")
+	configMapName := flag.String("configmap-name", common.DefaultConfigMapName, "ConfigMap the in-cluster run stores the report files in.")
+	configMapNamespace := flag.String("configmap-namespace", "", "Namespace of the report ConfigMap. Default: the namespace of the pod ($POD_NAMESPACE).")
+	configMapOverflow := flag.String("configmap-overflow", string(common.OverflowConfigMaps), "Where files that do not fit into the 1 MiB ConfigMap go: configmaps (<name>-2, ...) or secret.")
+	reportCR := flag.Bool("report-cr", false, "Also write the results into the checked cluster as a PrerequisiteReport custom resource (install prerequisitereport-crd.yaml first).")
+	reportCRName := flag.String("report-cr-name", common.DefaultReportResourceName, "Name of the PrerequisiteReport written with --report-cr.")
+	stdoutArtifact := flag.String("stdout", "", "Also stream one file to stdout: html, json, junit, sarif, markdown, values or dump. The terminal summary then goes to stderr.")
+	bundle := flag.Bool("bundle", false, "Also write a .tar.gz of all files with a manifest.json of their SHA-256 checksums.")
+	outputFormat := flag.String("output-format", string(common.FormatHTML), "Comma-separated report formats to write: html, json, junit, sarif, markdown. recommended-values.yaml is always written.")
+	noColor := flag.Bool("no-color", false, "Disable colors in the terminal summary (also disabled when NO_COLOR is set or stdout is not a terminal).")
+	dumpLevelFlag := flag.String("dump-level", string(common.DumpLevelNone), "Content of full-cluster-dump.yaml: none, summary (counts and anonymized nodes), redacted or full. redacted and full collect complete workload objects.")
+	fullDump := flag.Bool("full-dump", false, "Deprecated: same as --dump-level=full.")
+	redactionRules := flag.String("redaction-rules", "", "YAML file with redaction rules applied on top of the built-in ones, with --dump-level=redacted.")
+
+	failOnFlag := flag.String("fail-on", string(checks.FailOnFail), "Exit non-zero when a check result is at least this status: none, warn or fail.")
+
+	// PV provisioning check
+	pvCheckMode := flag.String("pv-check-mode", pvcheck.ModeSingle, "PV provisioning test coverage: single (one test), zone (one per zone) or node-pool (one per node pool).")
+	storageClass := flag.String("storage-class", "", "StorageClass tested by the PV provisioning check instead of the cluster default.")
+	allStorageClasses := flag.Bool("all-storage-classes", false, "Test PV provisioning against every dynamic StorageClass.")
+
+	// Network egress check
+	networkProbe := flag.Bool(network.ProbeFlag, false, "Internal: run as the network probe pod started by the network-egress check.")
+	networkImage := flag.String("network-probe-image", network.DefaultProbeImage, "Image of the network probe pod (must contain this checker binary).")
+	networkNamespace := flag.String("network-probe-namespace", network.DefaultProbeNamespace, "Namespace of the network probe pod.")
+	networkNodeSelector := flag.String("network-probe-node-selector", "", "Node selector of the network probe pod, as comma-separated key=value pairs.")
+	networkEndpointsFile := flag.String("network-endpoints-file", "", "File overriding the embedded list of endpoints checked for egress.")
+
+	// eBPF support check
+	ebpfImage := flag.String("ebpf-check-image", ebpf.DefaultImage, "Image of the eBPF check DaemonSet (needs /bin/sh, grep and zcat).")
+	ebpfNamespace := flag.String("ebpf-check-namespace", ebpf.DefaultNamespace, "Namespace of the eBPF check DaemonSet.")
 	flag.Parse()
 
-	clientset, inCluster := common.BuildKubeClient()
-	if clientset == nil {
-		log.Fatal("Could not create kube client. Exiting.")
+	if *networkProbe {
+		if err := network.RunProbe(os.Stdout); err != nil {
+			log.Fatalf("Network probe failed: %v", err)
+		}
+		return
 	}
 
-	ctx := context.Background()
+	formats, err := common.ParseOutputFormats(*outputFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// 1) Collect cluster data
-	clusterData, err := common.CollectClusterData(ctx, clientset)
+	dumpLevel, err := common.ParseDumpLevel(*dumpLevelFlag)
 	if err != nil {
-		log.Printf("Failed to collect cluster data: %v", err)
+		log.Fatal(err)
+	}
+	if *fullDump {
+		dumpLevel = common.DumpLevelFull
+	}
+	var redactor *common.Redactor
+	if dumpLevel == common.DumpLevelRedacted {
+		var userRules []common.RedactionRule
+		if *redactionRules != "" {
+			if userRules, err = common.LoadRedactionRules(*redactionRules); err != nil {
+				log.Fatalf("Could not load redaction rules: %v", err)
+			}
+		}
+		if redactor, err = common.NewRedactor(userRules); err != nil {
+			log.Fatalf("Invalid redaction rules: %v", err)
+		}
+	} else if *redactionRules != "" {
+		log.Fatal("--redaction-rules requires --dump-level=redacted")
 	}
 
-	// 2) Run checks
-	sizingResult := sizing.RunSizingChecker(ctx, clientset, clusterData)
+	switch *stdoutArtifact {
+	case "":
+	case common.ArtifactValues:
+	case common.ArtifactDump:
+		if dumpLevel == common.DumpLevelNone {
+			log.Fatal("--stdout=dump requires --dump-level")
+		}
+	default:
+		format, err := common.ParseOutputFormats(*stdoutArtifact)
+		if err != nil {
+			log.Fatalf("Invalid --stdout: %v", err)
+		}
+		if !slices.Contains(formats, format[0]) {
+			formats = append(formats, format[0])
+		}
+	}
+	if *stdoutArtifact != "" {
+		// Keep stdout clean for the streamed file
+		common.Console = os.Stderr
+	}
 
-	// Conditionally run resource-deploying checks
-	var pvResult *pvcheck.PVCheckResult
-	if *activeChecks {
-		pvResult = pvcheck.RunPVProvisioningCheck(ctx, clientset, clusterData)
-	} else {
-		// If not running active checks, fill with a "Skipped" result
-		pvResult = &pvcheck.PVCheckResult{
-			PassedCount:   0,
-			FailedCount:   0,
-			TotalNodes:    len(clusterData.Nodes),
-			ResultMessage: "Skipped (use --active-checks to run)",
+	overflow, err := common.ParseOverflowMode(*configMapOverflow)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	failOn, err := checks.ParseFailOn(*failOnFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pvMode, err := pvcheck.ParseMode(*pvCheckMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *storageClass != "" && *allStorageClasses {
+		log.Fatal("--storage-class and --all-storage-classes are mutually exclusive")
+	}
+
+	if *asGroups != "" && *asUser == "" {
+		log.Fatal("--as-group requires --as")
+	}
+
+	multiCluster := *contextsFlag != "" || *allContexts
+	if multiCluster && *kubeContext != "" {
+		log.Fatal("--context cannot be combined with --contexts or --all-contexts")
+	}
+	if *contextsFlag != "" && *allContexts {
+		log.Fatal("--contexts and --all-contexts are mutually exclusive")
+	}
+	if *watch {
+		if *fromDump != "" || multiCluster || *activeChecks || *stdoutArtifact != "" {
+			log.Fatal("--watch cannot be combined with --from-dump, --active-checks, --stdout, --contexts or --all-contexts")
+		}
+		if dumpLevel.NeedsFullObjects() {
+			log.Fatal("--watch only caches object metadata; use --dump-level none or summary")
 		}
+		if *watchInterval <= 0 || *watchDebounce <= 0 {
+			log.Fatal("--watch-interval and --watch-debounce must be positive")
+		}
+	}
+	if *serveAddr != "" && (multiCluster || *stdoutArtifact != "") {
+		log.Fatal("--serve cannot be combined with --stdout, --contexts or --all-contexts")
+	}
+	if multiCluster && *stdoutArtifact != "" {
+		log.Fatal("--stdout cannot be combined with --contexts or --all-contexts")
+	}
+	if *fromDump != "" && (multiCluster || *activeChecks || *reportCR) {
+		log.Fatal("--from-dump cannot be combined with --active-checks, --report-cr, --contexts or --all-contexts")
 	}
 
-	// 3) Build and export the final ReportData
-	finalReport := common.BuildReportData(clusterData, sizingResult)
-	finalReport.PVProvisioningMessage = pvResult.ResultMessage
+	nodeSelector, err := parseKeyValues(*networkNodeSelector)
+	if err != nil {
+		log.Fatalf("Invalid --network-probe-node-selector: %v", err)
+	}
+
+	registry := checks.DefaultRegistry(checks.Config{
+		Network: network.Options{
+			Image:         *networkImage,
+			Namespace:     *networkNamespace,
+			NodeSelector:  nodeSelector,
+			EndpointsFile: *networkEndpointsFile,
+		},
+		EBPF: ebpf.Options{
+			Image:     *ebpfImage,
+			Namespace: *ebpfNamespace,
+		},
+		NodeCompat: nodecompat.Options{
+			MinKernelVersion: *minKernelVersion,
+		},
+		Helm: permissions.Options{
+			Namespace: *helmNamespace,
+		},
+		PV: pvcheck.Options{
+			Mode:              pvMode,
+			StorageClass:      *storageClass,
+			AllStorageClasses: *allStorageClasses,
+		},
+	})
+	runOpts := checks.RunOptions{
+		ActiveChecks: *activeChecks,
+		Checks:       splitList(*checksFlag),
+		SkipChecks:   splitList(*skipChecksFlag),
+	}
+	if err := registry.Validate(append(runOpts.Checks, runOpts.SkipChecks...)); err != nil {
+		log.Fatalf("Invalid check selection: %v", err)
+	}
+
+	clientOpts := common.ClientOptions{
+		Kubeconfig: *kubeconfig,
+		Context:    *kubeContext,
+		As:         *asUser,
+		AsGroups:   splitList(*asGroups),
+	}
+	p := &pipeline{
+		registry: registry,
+		runOpts:  runOpts,
+		collectOpts: common.CollectOptions{
+			PageSize:     *pageSize,
+			Workers:      *collectWorkers,
+			CallTimeout:  *collectTimeout,
+			MetadataOnly: !dumpLevel.NeedsFullObjects(),
+		},
+		outputOpts: common.OutputOptions{
+			Formats:   formats,
+			Color:     !*noColor && common.ColorSupported(common.Console),
+			DumpLevel: dumpLevel,
+			Redactor:  redactor,
+			Dir:       *outputDir,
+			RunSubdir: *runSubdir,
+			Stdout:    *stdoutArtifact,
+			Bundle:    *bundle,
+			ConfigMap: common.ConfigMapOptions{
+				Name:      *configMapName,
+				Namespace: *configMapNamespace,
+				Overflow:  overflow,
+			},
+		},
+	}
+
+	if *reportCR {
+		p.reportResource = *reportCRName
+	}
+	if *watch || *serveAddr != "" {
+		// Every run replaces the files of the previous one
+		p.outputOpts.RunSubdir = false
+	}
+
+	// Cancel on Ctrl-C / SIGTERM so active checks still clean up what they deployed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *serveAddr != "" {
+		p.server = common.NewReportServer()
+		go func() {
+			if err := p.server.ListenAndServe(ctx, *serveAddr); err != nil {
+				log.Fatalf("Report server failed: %v", err)
+			}
+		}()
+	}
+
+	// runOnce produces one report; with --serve it runs again on every request
+	var runOnce func() (*common.ReportData, error)
+	var checkResults []common.CheckResult
+	switch {
+	case *fromDump != "":
+		runOnce = func() (*common.ReportData, error) {
+			clusterData, err := common.LoadClusterData(*fromDump)
+			if err != nil {
+				return nil, fmt.Errorf("could not load cluster dump: %w", err)
+			}
+			if clusterData.ClusterDetails.Name == "" {
+				clusterData.ClusterDetails.Name = strings.TrimSuffix(filepath.Base(*fromDump), filepath.Ext(*fromDump))
+			}
+			finalReport := p.evaluate(ctx, nil, clusterData)
+			return finalReport, p.output(ctx, nil, false, finalReport)
+		}
+	case multiCluster:
+		contexts := splitList(*contextsFlag)
+		if *allContexts {
+			if contexts, err = common.ListContexts(clientOpts); err != nil {
+				log.Fatalf("Could not list kubeconfig contexts: %v", err)
+			}
+		}
+		if len(contexts) == 0 {
+			log.Fatal("No kubeconfig contexts to check")
+		}
+		checkResults = runMultiCluster(ctx, p, clientOpts, contexts, *parallelClusters, *clusterTimeout)
+	case *watch:
+		clientset, restConfig, inCluster := common.BuildKubeClient(clientOpts)
+		if clientset == nil {
+			log.Fatal("Could not create kube client. Exiting.")
+		}
+		err := runWatch(ctx, p, clientset, restConfig, inCluster, common.ClusterName(clientOpts, inCluster), watchOptions{
+			interval:       *watchInterval,
+			debounce:       *watchDebounce,
+			driftThreshold: *driftThreshold,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		clientset, restConfig, inCluster := common.BuildKubeClient(clientOpts)
+		if clientset == nil {
+			log.Fatal("Could not create kube client. Exiting.")
+		}
+
+		runOnce = func() (*common.ReportData, error) {
+			finalReport, err := p.run(ctx, common.ClusterName(clientOpts, inCluster), clientset, restConfig)
+			if err != nil {
+				return nil, err
+			}
+			return finalReport, p.output(ctx, restConfig, inCluster, finalReport)
+		}
+	}
 
-	common.GenerateOutput(finalReport, inCluster)
+	if runOnce != nil {
+		finalReport, err := runOnce()
+		if p.server != nil {
+			// Keep serving: /readyz and the file index show the error until a run succeeds
+			if err != nil {
+				log.Printf("Run failed: %v", err)
+				p.server.RunFailed(err)
+			}
+			serveRuns(ctx, p.server, runOnce)
+			return
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		checkResults = finalReport.CheckResults
+	}
+	if p.server != nil {
+		// --watch returned because ctx is done
+		return
+	}
+
+	// Exit with a code reflecting the worst check result
+	if code := checks.ExitCode(checkResults, failOn); code != checks.ExitCodeOK {
+		log.Printf("Prerequisite checks did not pass (worst status: %s, --fail-on=%s), exiting with code %d",
+			checks.WorstStatus(checkResults).Label(), failOn, code)
+		stop()
+		os.Exit(code)
+	}
+}
+
+// serveRuns runs runOnce on every run requested through the server, until ctx is done.
+// A failed run is shown by the server, which keeps serving the previous files.
+func serveRuns(ctx context.Context, server *common.ReportServer, runOnce func() (*common.ReportData, error)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-server.Triggers():
+			log.Printf("Running the checks again, as requested")
+			if _, err := runOnce(); err != nil {
+				log.Printf("Requested run failed: %v", err)
+				server.RunFailed(err)
+			}
+		}
+	}
+}
+
+// splitList turns a comma-separated flag value into a list, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseKeyValues turns "k1=v1,k2=v2" into a map.
+func parseKeyValues(value string) (map[string]string, error) {
+	items := splitList(value)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	result := make(map[string]string, len(items))
+	for _, item := range items {
+		k, v, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", item)
+		}
+		result[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return result, nil
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
+)
+
+const (
+	defaultParallelClusters = 4
+	defaultClusterTimeout   = 15 * time.Minute
+)
+
+// runMultiCluster checks every context, a bounded number of clusters at a time, writes the
+// per-cluster outputs plus a summary comparing them, and returns the check results of all clusters.
+// Every cluster has its own time budget, so a slow or unreachable one cannot hold up the others.
+func runMultiCluster(
+	ctx context.Context,
+	p *pipeline,
+	clientOpts common.ClientOptions,
+	contexts []string,
+	parallel int,
+	timeout time.Duration,
+) []common.CheckResult {
+	if parallel <= 0 {
+		parallel = defaultParallelClusters
+	}
+	baseDir := p.outputOpts.Dir
+	if baseDir == "" {
+		baseDir = filepath.Join(os.TempDir(), "kubescape-prerequisites")
+	}
+	if p.outputOpts.RunSubdir {
+		baseDir = filepath.Join(baseDir, time.Now().Format("20060102-150405")+"-clusters")
+	}
+
+	runs := make([]common.ClusterRun, len(contexts))
+	slots := make(chan struct{}, parallel)
+	var outputMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i, name := range contexts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			run := checkCluster(ctx, p, clientOpts, name, timeout)
+			if run.Report == nil {
+				log.Printf("Cluster %s was not checked: %s", name, run.Error)
+				runs[i] = run
+				return
+			}
+
+			// Print one cluster's output at a time
+			outputMu.Lock()
+			defer outputMu.Unlock()
+			dirName := common.SafeFileName(name)
+			opts := p.outputOpts
+			opts.Dir = filepath.Join(baseDir, dirName)
+			opts.RunSubdir = false
+			fmt.Fprintf(common.Console, "\n🌐 Cluster: %s\n", name)
+			if _, err := common.GenerateOutput(run.Report, false, opts); err != nil {
+				log.Printf("Could not write the report of cluster %s: %v", name, err)
+			}
+			run.ReportPath = dirName + "/" + common.HTMLReportFile
+			runs[i] = run
+		}()
+	}
+	wg.Wait()
+
+	summary := common.BuildClustersSummary(runs)
+	if _, err := common.WriteClustersSummary(baseDir, common.BuildClustersSummaryHTML(summary, common.ClustersSummaryHTML)); err != nil {
+		log.Fatal(err)
+	}
+
+	var results []common.CheckResult
+	for _, run := range runs {
+		if run.Report == nil {
+			results = append(results, common.CheckResult{
+				Name:   "cluster-access",
+				Status: common.StatusError,
+				Reason: fmt.Sprintf("%s: %s", run.Context, run.Error),
+			})
+			continue
+		}
+		results = append(results, run.Report.CheckResults...)
+	}
+	return results
+}
+
+// checkCluster runs the pipeline against one kubeconfig context within timeout.
+func checkCluster(ctx context.Context, p *pipeline, clientOpts common.ClientOptions, name string, timeout time.Duration) (run common.ClusterRun) {
+	start := time.Now()
+	run.Context = name
+	defer func() { run.Duration = time.Since(start) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	clientOpts.Context = name
+	clientset, restConfig, _ := common.BuildKubeClient(clientOpts)
+	if clientset == nil {
+		run.Error = "could not create kube client"
+		return run
+	}
+
+	// Skip unreachable clusters right away instead of running every check against them
+	callTimeout := p.collectOpts.CallTimeout
+	if callTimeout <= 0 {
+		callTimeout = common.DefaultCallTimeout
+	}
+	if _, err := common.ServerVersion(ctx, clientset, callTimeout); err != nil {
+		run.Error = fmt.Sprintf("cluster unreachable: %v", err)
+		return run
+	}
+
+	report, err := p.run(ctx, name, clientset, restConfig)
+	if err != nil {
+		run.Error = err.Error()
+		return run
+	}
+	p.publish(ctx, restConfig, report)
+	run.Report = report
+	return run
+}
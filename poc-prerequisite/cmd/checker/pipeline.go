@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/checks"
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/checks/sizing"
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+)
+
+// pipeline holds the settings shared by every cluster that is checked.
+type pipeline struct {
+	registry    *checks.Registry
+	runOpts     checks.RunOptions
+	collectOpts common.CollectOptions
+	outputOpts  common.OutputOptions
+	// reportResource is the PrerequisiteReport written to the checked cluster; empty writes none.
+	reportResource string
+	// server serves the files of the latest run with --serve; nil otherwise.
+	server *common.ReportServer
+}
+
+// run collects the cluster data of clusterName, runs sizing and every registered check, and builds the report.
+func (p *pipeline) run(ctx context.Context, clusterName string, clientset *kubernetes.Clientset, restConfig *rest.Config) (*common.ReportData, error) {
+	metadataClient, err := metadata.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not create metadata client: %w", err)
+	}
+
+	// 1) Collect cluster data
+	clusterData, err := common.CollectClusterData(ctx, clientset, metadataClient, p.collectOpts)
+	if err != nil {
+		log.Printf("Failed to collect cluster data: %v", err)
+	}
+	if clusterData == nil {
+		return nil, fmt.Errorf("no cluster data collected")
+	}
+	clusterData.ClusterDetails.Name = clusterName
+
+	return p.evaluate(ctx, clientset, clusterData), nil
+}
+
+// output writes the report files, then updates the PrerequisiteReport and the served files.
+// restConfig is nil when the report was not built from a live cluster. The error of building or
+// storing the files is returned after the other sinks were updated; the server keeps the
+// previous files when none could be built.
+func (p *pipeline) output(ctx context.Context, restConfig *rest.Config, inCluster bool, report *common.ReportData) error {
+	artifacts, err := common.GenerateOutput(report, inCluster, p.outputOpts)
+	if restConfig != nil {
+		p.publish(ctx, restConfig, report)
+	}
+	if p.server != nil && artifacts != nil {
+		p.server.Update(report, artifacts)
+	}
+	if err != nil {
+		return fmt.Errorf("could not write the report files: %w", err)
+	}
+	return nil
+}
+
+// triggers receives the runs requested through the server; it is nil, and never ready, without --serve.
+func (p *pipeline) triggers() <-chan struct{} {
+	if p.server == nil {
+		return nil
+	}
+	return p.server.Triggers()
+}
+
+// publish writes the report into the checked cluster as a PrerequisiteReport, when enabled.
+// A failure is only logged: the report files are written regardless.
+func (p *pipeline) publish(ctx context.Context, restConfig *rest.Config, report *common.ReportData) {
+	if p.reportResource == "" {
+		return
+	}
+	if err := common.ApplyPrerequisiteReport(ctx, restConfig, p.reportResource, report); err != nil {
+		log.Printf("Could not write PrerequisiteReport %s: %v", p.reportResource, err)
+		return
+	}
+	fmt.Fprintf(common.Console, "📄 PrerequisiteReport %s updated (kubectl get %s)\n", p.reportResource, common.PrerequisiteReportResource)
+}
+
+// evaluate runs sizing and the checks on already collected (or loaded) cluster data.
+// clientset is nil when replaying a dump; checks that need the cluster are then skipped.
+func (p *pipeline) evaluate(ctx context.Context, clientset *kubernetes.Clientset, clusterData *common.ClusterData) *common.ReportData {
+	// 2) Run sizing and every registered prerequisite check
+	sizingResult := sizing.RunSizingChecker(ctx, clientset, clusterData)
+
+	checkResults := p.registry.Run(ctx, clientset, clusterData, p.runOpts)
+
+	// 3) Build the final ReportData
+	return common.BuildReportData(clusterData, sizingResult, checkResults)
+}
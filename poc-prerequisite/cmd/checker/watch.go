@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	defaultWatchInterval        = time.Hour
+	defaultWatchDebounce        = 2 * time.Minute
+	defaultSizingDriftThreshold = 20.0
+)
+
+// Event reasons emitted in watch mode.
+const (
+	reasonPrerequisiteFailing   = "PrerequisiteFailing"
+	reasonPrerequisiteRecovered = "PrerequisiteRecovered"
+	reasonSizingDrift           = "SizingDrift"
+)
+
+// watchOptions tune the continuous mode.
+type watchOptions struct {
+	// interval re-evaluates the cluster even when nothing relevant changed.
+	interval time.Duration
+	// debounce delays the re-evaluation after a change, so that a rollout or a scale-up
+	// is evaluated once.
+	debounce time.Duration
+	// driftThreshold is the change of a sizing input, in percent of its baseline, that emits an Event.
+	driftThreshold float64
+}
+
+// runWatch keeps the cluster data up to date through informers and re-runs sizing and the
+// passive checks on relevant changes and every interval, until ctx is done.
+// Every run updates the report sinks; regressions and sizing drift are emitted as Events.
+func runWatch(
+	ctx context.Context,
+	p *pipeline,
+	clientset *kubernetes.Clientset,
+	restConfig *rest.Config,
+	inCluster bool,
+	clusterName string,
+	opts watchOptions,
+) error {
+	metadataClient, err := metadata.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("could not create metadata client: %w", err)
+	}
+
+	watcher := common.NewClusterWatcher(clientset, metadataClient, 0, p.collectOpts.CallTimeout)
+	syncTimeout := p.collectOpts.CallTimeout
+	if syncTimeout <= 0 {
+		syncTimeout = common.DefaultCallTimeout
+	}
+	watcher.Start(ctx, syncTimeout)
+
+	events := newEventEmitter(clientset, p.reportResource)
+	defer events.shutdown()
+
+	var last, baseline *common.ReportData
+	evaluate := func(trigger string) {
+		log.Printf("Evaluating prerequisites (%s)", trigger)
+		clusterData := watcher.Snapshot(ctx)
+		clusterData.ClusterDetails.Name = clusterName
+		report := p.evaluate(ctx, clientset, clusterData)
+		// A store that fails, e.g. an API server blip, is retried by the next run
+		if err := p.output(ctx, restConfig, inCluster, report); err != nil {
+			log.Printf("%v", err)
+			if p.server != nil {
+				p.server.RunFailed(err)
+			}
+		}
+
+		// Partially filled caches would make the next complete run look like drift or regressions
+		if unsynced := unsyncedKinds(clusterData); len(unsynced) > 0 {
+			log.Printf("Informer caches not synced yet (%s): Events are held back until they are", strings.Join(unsynced, ", "))
+			return
+		}
+		if last != nil {
+			for _, change := range checkChanges(last, report) {
+				events.emit(change.eventType, change.reason, change.message)
+			}
+		}
+		if baseline == nil {
+			baseline = report
+		} else if drift := sizingDrift(baseline, report, opts.driftThreshold); drift != "" {
+			events.emit(corev1.EventTypeWarning, reasonSizingDrift, drift)
+			// Compare the next runs with the sizing the drift was reported for
+			baseline = report
+		}
+		last = report
+	}
+
+	evaluate("start")
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+	var debounced <-chan time.Time
+	var changed []string
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			evaluate("interval")
+		case <-p.triggers():
+			evaluate("requested")
+		case kind := <-watcher.Changes():
+			changed = appendUnique(changed, kind)
+			if debounced == nil {
+				debounced = time.After(opts.debounce)
+			}
+		case <-debounced:
+			evaluate("changed " + strings.Join(changed, ", "))
+			debounced, changed = nil, nil
+		}
+	}
+}
+
+// unsyncedKinds returns the kinds whose informer cache was not synced when the snapshot was taken.
+func unsyncedKinds(cd *common.ClusterData) []string {
+	var kinds []string
+	for _, kind := range cd.MissingKinds() {
+		if strings.HasPrefix(cd.CollectionErrors[kind], common.InformerNotSyncedError) {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+func appendUnique(items []string, item string) []string {
+	for _, i := range items {
+		if i == item {
+			return items
+		}
+	}
+	return append(items, item)
+}
+
+// checkChange is a check whose status got worse or recovered between two runs.
+type checkChange struct {
+	eventType string
+	reason    string
+	message   string
+}
+
+// checkChanges compares the check results of two runs: a check that passed and now fails or
+// warns is a regression, a check that did not pass and now does recovered.
+func checkChanges(previous, current *common.ReportData) []checkChange {
+	before := map[string]common.CheckStatus{}
+	for _, r := range previous.CheckResults {
+		before[r.Name] = r.Status
+	}
+	var changes []checkChange
+	for _, r := range current.CheckResults {
+		old, ok := before[r.Name]
+		if !ok {
+			continue
+		}
+		switch {
+		case old == common.StatusPass && r.Status.Rank() > old.Rank():
+			message := fmt.Sprintf("Check %s is now %s (was %s)", r.Name, r.Status.Label(), old.Label())
+			if r.Reason != "" {
+				message += ": " + r.Reason
+			}
+			changes = append(changes, checkChange{corev1.EventTypeWarning, reasonPrerequisiteFailing, message})
+		case old.Rank() > common.StatusPass.Rank() && r.Status == common.StatusPass:
+			changes = append(changes, checkChange{corev1.EventTypeNormal, reasonPrerequisiteRecovered,
+				fmt.Sprintf("Check %s passes again (was %s)", r.Name, old.Label())})
+		}
+	}
+	return changes
+}
+
+// sizingDrift describes the sizing inputs that moved more than threshold percent away from
+// the baseline, and the recommended resources that changed with them; "" when none did.
+func sizingDrift(baseline, current *common.ReportData, threshold float64) string {
+	inputs := []struct {
+		name     string
+		old, new int
+	}{
+		{"total resources", baseline.TotalResources, current.TotalResources},
+		{"max node memory (MB)", baseline.MaxNodeMemoryMB, current.MaxNodeMemoryMB},
+		{"max node CPU (m)", baseline.MaxNodeCPUCapacity, current.MaxNodeCPUCapacity},
+		{"largest container image (MB)", baseline.LargestContainerImageMB, current.LargestContainerImageMB},
+	}
+	var drifted []string
+	for _, in := range inputs {
+		if in.old == 0 || in.old == in.new {
+			continue
+		}
+		percent := float64(in.new-in.old) / float64(in.old) * 100
+		if percent >= threshold || -percent >= threshold {
+			drifted = append(drifted, fmt.Sprintf("%s %d -> %d (%+.0f%%)", in.name, in.old, in.new, percent))
+		}
+	}
+	if len(drifted) == 0 {
+		return ""
+	}
+
+	var resources []string
+	for comp, finals := range current.FinalResourceAllocations {
+		for field, val := range finals {
+			if old := baseline.FinalResourceAllocations[comp][field]; old != val {
+				resources = append(resources, fmt.Sprintf("%s.%s %s -> %s", comp, field, old, val))
+			}
+		}
+	}
+	sort.Strings(resources)
+
+	message := fmt.Sprintf("Sizing inputs drifted beyond %.0f%%: %s.", threshold, strings.Join(drifted, ", "))
+	if len(resources) > 0 {
+		message += " Recommended resources changed: " + strings.Join(resources, ", ") + "; update the Helm values."
+	}
+	return message
+}
+
+// eventEmitter records Events on the PrerequisiteReport, or else on the checker pod.
+// Without either (e.g. a local run without --report-cr) the events are only logged.
+type eventEmitter struct {
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	target      *corev1.ObjectReference
+}
+
+func newEventEmitter(clientset *kubernetes.Clientset, reportResource string) *eventEmitter {
+	e := &eventEmitter{}
+	switch {
+	case reportResource != "":
+		e.target = &corev1.ObjectReference{
+			APIVersion: common.PrerequisiteReportGroup + "/" + common.PrerequisiteReportVersion,
+			Kind:       common.PrerequisiteReportKind,
+			Name:       reportResource,
+		}
+	case os.Getenv("POD_NAME") != "":
+		e.target = &corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Namespace:  common.PodNamespace(),
+			Name:       os.Getenv("POD_NAME"),
+		}
+	default:
+		log.Printf("Events are only logged: set --report-cr or run in a pod with POD_NAME set to record them")
+		return e
+	}
+
+	e.broadcaster = record.NewBroadcaster()
+	e.broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	e.recorder = e.broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "kubescape-prerequisites"})
+	return e
+}
+
+func (e *eventEmitter) emit(eventType, reason, message string) {
+	log.Printf("%s %s: %s", eventType, reason, message)
+	if e.recorder != nil {
+		e.recorder.Event(e.target, eventType, reason, message)
+	}
+}
+
+func (e *eventEmitter) shutdown() {
+	if e.broadcaster != nil {
+		e.broadcaster.Shutdown()
+	}
+}
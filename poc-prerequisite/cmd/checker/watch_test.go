@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func reportWith(statuses map[string]common.CheckStatus) *common.ReportData {
+	report := &common.ReportData{}
+	for name, status := range statuses {
+		report.CheckResults = append(report.CheckResults, common.CheckResult{Name: name, Status: status})
+	}
+	return report
+}
+
+func TestCheckChanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		previous   common.CheckStatus
+		current    common.CheckStatus
+		removed    bool
+		wantReason string
+		wantType   string
+	}{
+		{name: "pass to warn", previous: common.StatusPass, current: common.StatusWarn, wantReason: reasonPrerequisiteFailing, wantType: corev1.EventTypeWarning},
+		{name: "pass to fail", previous: common.StatusPass, current: common.StatusFail, wantReason: reasonPrerequisiteFailing, wantType: corev1.EventTypeWarning},
+		{name: "error to pass", previous: common.StatusError, current: common.StatusPass, wantReason: reasonPrerequisiteRecovered, wantType: corev1.EventTypeNormal},
+		{name: "warn to fail is no new regression", previous: common.StatusWarn, current: common.StatusFail},
+		{name: "skip to pass", previous: common.StatusSkip, current: common.StatusPass},
+		{name: "unchanged", previous: common.StatusPass, current: common.StatusPass},
+		{name: "check removed", previous: common.StatusPass, removed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := reportWith(map[string]common.CheckStatus{"pv-provisioning": tt.previous})
+			current := reportWith(map[string]common.CheckStatus{"pv-provisioning": tt.current})
+			if tt.removed {
+				current = reportWith(map[string]common.CheckStatus{"node-compatibility": common.StatusFail})
+			}
+
+			changes := checkChanges(previous, current)
+			if tt.wantReason == "" {
+				if len(changes) != 0 {
+					t.Errorf("unexpected changes %+v", changes)
+				}
+				return
+			}
+			if len(changes) != 1 {
+				t.Fatalf("got %d changes, want 1", len(changes))
+			}
+			if changes[0].reason != tt.wantReason || changes[0].eventType != tt.wantType {
+				t.Errorf("got %s/%s, want %s/%s", changes[0].eventType, changes[0].reason, tt.wantType, tt.wantReason)
+			}
+			if !strings.Contains(changes[0].message, "pv-provisioning") {
+				t.Errorf("message %q does not name the check", changes[0].message)
+			}
+		})
+	}
+}
+
+func TestSizingDrift(t *testing.T) {
+	allocations := func(memLim string) map[string]map[string]string {
+		return map[string]map[string]string{"nodeAgent": {"memLim": memLim, "cpuReq": "100m"}}
+	}
+	tests := []struct {
+		name          string
+		baseline      int
+		current       int
+		wantDrift     bool
+		wantResources bool
+	}{
+		{name: "below threshold", baseline: 1000, current: 1150},
+		{name: "exactly the threshold", baseline: 1000, current: 1200, wantDrift: true, wantResources: true},
+		{name: "shrinking beyond the threshold", baseline: 1000, current: 700, wantDrift: true, wantResources: true},
+		{name: "zero baseline is skipped", baseline: 0, current: 5000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseline := &common.ReportData{TotalResources: tt.baseline, FinalResourceAllocations: allocations("500Mi")}
+			current := &common.ReportData{TotalResources: tt.current, FinalResourceAllocations: allocations("800Mi")}
+
+			drift := sizingDrift(baseline, current, 20)
+			if (drift != "") != tt.wantDrift {
+				t.Fatalf("drift = %q, want drift %v", drift, tt.wantDrift)
+			}
+			if !tt.wantDrift {
+				return
+			}
+			if !strings.Contains(drift, "total resources") {
+				t.Errorf("drift %q does not name the input", drift)
+			}
+			if got := strings.Contains(drift, "nodeAgent.memLim 500Mi -> 800Mi"); got != tt.wantResources {
+				t.Errorf("drift %q lists changed resources: %v, want %v", drift, got, tt.wantResources)
+			}
+			if strings.Contains(drift, "cpuReq") {
+				t.Errorf("drift %q lists an unchanged resource", drift)
+			}
+		})
+	}
+}
+
+func TestUnsyncedKinds(t *testing.T) {
+	cd := &common.ClusterData{CollectionErrors: map[string]string{
+		"pods":    common.InformerNotSyncedError + ": forbidden",
+		"nodes":   common.InformerNotSyncedError,
+		"version": "connection refused",
+	}}
+	got := unsyncedKinds(cd)
+	if strings.Join(got, ",") != "nodes,pods" {
+		t.Errorf("unsyncedKinds = %v, want [nodes pods]", got)
+	}
+	if got := unsyncedKinds(&common.ClusterData{}); len(got) != 0 {
+		t.Errorf("unsyncedKinds of a complete snapshot = %v", got)
+	}
+}
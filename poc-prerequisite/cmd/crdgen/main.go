@@ -0,0 +1,19 @@
+// Command crdgen writes the PrerequisiteReport CRD manifest:
+//
+//	go run ./cmd/crdgen > prerequisitereport-crd.yaml
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
+)
+
+func main() {
+	manifest, err := common.BuildCRDManifest()
+	if err != nil {
+		log.Fatalf("Could not build the CRD manifest: %v", err)
+	}
+	fmt.Print("# Generated by `go run ./cmd/crdgen`, do not edit.\n" + manifest)
+}
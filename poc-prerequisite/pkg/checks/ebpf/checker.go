@@ -0,0 +1,219 @@
+package ebpf
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	DefaultImage     = "busybox:1.36"
+	DefaultNamespace = "default"
+
+	podsReadyTimeout = 2 * time.Minute
+)
+
+// Options configures the check DaemonSet.
+type Options struct {
+	Image     string
+	Namespace string
+}
+
+// Checker verifies on every Linux node that the kernel supports eBPF with BTF,
+// which node-agent depends on, using a short-lived DaemonSet.
+type Checker struct {
+	opts Options
+}
+
+func NewChecker(opts Options) *Checker {
+	if opts.Image == "" {
+		opts.Image = DefaultImage
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = DefaultNamespace
+	}
+	return &Checker{opts: opts}
+}
+
+func (c *Checker) Name() string {
+	return "ebpf-support"
+}
+
+func (c *Checker) Description() string {
+	return "Kernel eBPF and BTF support on every Linux node, required by node-agent"
+}
+
+func (c *Checker) Type() common.CheckType {
+	return common.CheckTypeActive
+}
+
+func (c *Checker) Tags() []string {
+	return []string{"ebpf", "node"}
+}
+
+func (c *Checker) Run(ctx context.Context, clientset *kubernetes.Clientset, clusterData *common.ClusterData) *common.CheckResult {
+	ns := c.opts.Namespace
+	if err := deployDaemonSet(ctx, clientset, ns, c.opts.Image); err != nil {
+		return &common.CheckResult{
+			Status:      common.StatusError,
+			Reason:      fmt.Sprintf("Failed to create DaemonSet %s/%s: %v", ns, daemonSetName, err),
+			Remediation: "Ensure the identity running the checker may create DaemonSets and that no admission policy rejects hostPath volumes.",
+		}
+	}
+	defer func() {
+		if delErr := deleteDaemonSet(context.Background(), clientset, ns); delErr != nil {
+			log.Printf("Warning: could not delete DaemonSet %s/%s: %v", ns, daemonSetName, delErr)
+		}
+	}()
+
+	waitForPods(ctx, clientset, ns, podsReadyTimeout)
+
+	pods, err := clientset.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: "app=" + daemonSetName})
+	if err != nil {
+		return &common.CheckResult{
+			Status: common.StatusError,
+			Reason: fmt.Sprintf("Failed to list eBPF check pods: %v", err),
+		}
+	}
+
+	verdicts, unverified := c.collectVerdicts(ctx, clientset, pods.Items, clusterData)
+	return buildResult(verdicts, unverified, nodePools(clusterData))
+}
+
+// collectVerdicts reads the verdict of every ready pod. Linux nodes without a verdict
+// are returned as unverified, mapped to the reason.
+func (c *Checker) collectVerdicts(
+	ctx context.Context,
+	clientset *kubernetes.Clientset,
+	pods []corev1.Pod,
+	clusterData *common.ClusterData,
+) ([]*NodeVerdict, map[string]string) {
+	var verdicts []*NodeVerdict
+	unverified := map[string]string{}
+
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		logs, err := clientset.CoreV1().Pods(c.opts.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).DoRaw(ctx)
+		if err != nil {
+			unverified[pod.Spec.NodeName] = podStatusDetail(pod)
+			continue
+		}
+		v, ok := parseVerdict(string(logs))
+		if !ok {
+			unverified[pod.Spec.NodeName] = podStatusDetail(pod)
+			continue
+		}
+		v.Node = pod.Spec.NodeName
+		verdicts = append(verdicts, v)
+	}
+
+	seen := map[string]bool{}
+	for _, v := range verdicts {
+		seen[v.Node] = true
+	}
+	if clusterData != nil {
+		for _, node := range clusterData.Nodes {
+			if node.Status.NodeInfo.OperatingSystem != "linux" || seen[node.Name] {
+				continue
+			}
+			if _, ok := unverified[node.Name]; !ok {
+				unverified[node.Name] = "no check pod was scheduled on the node"
+			}
+		}
+	}
+	return verdicts, unverified
+}
+
+func nodePools(clusterData *common.ClusterData) map[string]string {
+	pools := map[string]string{}
+	if clusterData == nil {
+		return pools
+	}
+	for _, node := range clusterData.Nodes {
+		pools[node.Name] = common.NodePool(node)
+	}
+	return pools
+}
+
+func buildResult(verdicts []*NodeVerdict, unverified map[string]string, pools map[string]string) *common.CheckResult {
+	sort.Slice(verdicts, func(i, j int) bool { return verdicts[i].Node < verdicts[j].Node })
+
+	poolOf := func(node string) string {
+		if p := pools[node]; p != "" {
+			return p
+		}
+		return "-"
+	}
+
+	table := &common.ResultTable{Columns: []string{
+		"Node", "Node pool", "Kernel", "Config source", "CONFIG_BPF", "CONFIG_BPF_SYSCALL", "CONFIG_DEBUG_INFO_BTF", "BTF vmlinux", "Verdict",
+	}}
+	var unsupported, unverifiedRefs []common.ObjectRef
+	var unsupportedNames []string
+
+	for _, v := range verdicts {
+		verdict := "supported"
+		if !v.Supported {
+			verdict = "not supported: " + v.Reason
+			unsupported = append(unsupported, common.ObjectRef{Kind: "Node", Name: v.Node, Detail: fmt.Sprintf("pool %s, kernel %s: %s", poolOf(v.Node), v.Kernel, v.Reason)})
+			unsupportedNames = append(unsupportedNames, fmt.Sprintf("%s (pool %s)", v.Node, poolOf(v.Node)))
+		}
+		table.Rows = append(table.Rows, []string{
+			v.Node, poolOf(v.Node), v.Kernel, v.Source, v.BPF, v.BPFSyscall, v.BTF, v.VMLinux, verdict,
+		})
+	}
+
+	nodes := make([]string, 0, len(unverified))
+	for node := range unverified {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		unverifiedRefs = append(unverifiedRefs, common.ObjectRef{Kind: "Node", Name: node, Detail: fmt.Sprintf("pool %s: %s", poolOf(node), unverified[node])})
+		table.Rows = append(table.Rows, []string{node, poolOf(node), "", "", "", "", "", "", "unverified: " + unverified[node]})
+	}
+
+	total := len(verdicts) + len(unverified)
+	switch {
+	case len(unsupported) > 0:
+		return &common.CheckResult{
+			Status:      common.StatusFail,
+			Severity:    common.SeverityHigh,
+			Reason:      fmt.Sprintf("eBPF is not supported on %d of %d nodes: %s.", len(unsupported), total, strings.Join(unsupportedNames, ", ")),
+			Evidence:    append(unsupported, unverifiedRefs...),
+			Remediation: "Run node-agent only on node pools with a kernel built with CONFIG_BPF, CONFIG_BPF_SYSCALL and BTF (e.g. kernel 5.4+ on a current distro image), or upgrade the node image of the listed pools.",
+			Details:     table,
+		}
+	case len(unverified) > 0:
+		return &common.CheckResult{
+			Status:      common.StatusWarn,
+			Severity:    common.SeverityMedium,
+			Reason:      fmt.Sprintf("eBPF support could not be verified on %d of %d nodes.", len(unverified), total),
+			Evidence:    unverifiedRefs,
+			Remediation: "Check that the check image can be pulled on every node and that the nodes have capacity for a small pod.",
+			Details:     table,
+		}
+	case total == 0:
+		return &common.CheckResult{
+			Status: common.StatusError,
+			Reason: "No Linux node reported an eBPF verdict.",
+		}
+	default:
+		return &common.CheckResult{
+			Status:  common.StatusPass,
+			Reason:  fmt.Sprintf("eBPF is supported on all %d Linux nodes.", total),
+			Details: table,
+		}
+	}
+}
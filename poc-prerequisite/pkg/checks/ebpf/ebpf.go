@@ -0,0 +1,235 @@
+package ebpf
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	daemonSetName = "armo-ebpf-check"
+	resultPrefix  = "ARMO-EBPF-CHECK "
+)
+
+// checkScript inspects the kernel config (from /boot, or /proc/config.gz as a fallback)
+// and the BTF blob exported by the kernel, and prints one result line for the node.
+const checkScript = `
+KERNEL=$(uname -r)
+CONFIG=""
+SOURCE=none
+if [ -f /host/boot/config-$KERNEL ]; then
+  CONFIG=/host/boot/config-$KERNEL
+  SOURCE=boot-config
+elif [ -f /proc/config.gz ]; then
+  zcat /proc/config.gz > /tmp/config
+  CONFIG=/tmp/config
+  SOURCE=proc-config
+fi
+flag() {
+  if [ -z "$CONFIG" ]; then echo unknown
+  elif grep -q "^$1=y$" "$CONFIG"; then echo y
+  else echo n
+  fi
+}
+VMLINUX=n
+[ -f /sys/kernel/btf/vmlinux ] && VMLINUX=y
+echo "` + resultPrefix + `node=$NODE_NAME kernel=$KERNEL source=$SOURCE bpf=$(flag CONFIG_BPF) bpf_syscall=$(flag CONFIG_BPF_SYSCALL) btf=$(flag CONFIG_DEBUG_INFO_BTF) vmlinux=$VMLINUX"
+touch /tmp/ready
+exec sleep 3600
+`
+
+// NodeVerdict is the eBPF support verdict for a single node.
+type NodeVerdict struct {
+	Node       string
+	Kernel     string
+	Source     string // boot-config, proc-config or none
+	BPF        string // y, n or unknown
+	BPFSyscall string
+	BTF        string // CONFIG_DEBUG_INFO_BTF
+	VMLinux    string // /sys/kernel/btf/vmlinux present
+	Supported  bool
+	Reason     string
+}
+
+// evaluate decides support from the collected flags. BTF may come either from
+// CONFIG_DEBUG_INFO_BTF or, when no kernel config is readable, from /sys/kernel/btf/vmlinux.
+func (v *NodeVerdict) evaluate() {
+	hasBTF := v.BTF == "y" || v.VMLinux == "y"
+	switch {
+	case v.Source == "none" && v.VMLinux == "y":
+		v.Supported = true
+		v.Reason = "no kernel config found, but the kernel exports BTF (/sys/kernel/btf/vmlinux)"
+	case v.Source == "none":
+		v.Reason = "no kernel config found and no /sys/kernel/btf/vmlinux"
+	case v.BPF != "y" || v.BPFSyscall != "y":
+		v.Reason = "kernel built without CONFIG_BPF / CONFIG_BPF_SYSCALL"
+	case !hasBTF:
+		v.Reason = "kernel built without BTF (CONFIG_DEBUG_INFO_BTF)"
+	default:
+		v.Supported = true
+		v.Reason = "eBPF and BTF are supported"
+	}
+}
+
+func parseVerdict(logs string) (*NodeVerdict, bool) {
+	scanner := bufio.NewScanner(strings.NewReader(logs))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, resultPrefix) {
+			continue
+		}
+		fields := map[string]string{}
+		for _, kv := range strings.Fields(strings.TrimPrefix(line, resultPrefix)) {
+			if k, val, ok := strings.Cut(kv, "="); ok {
+				fields[k] = val
+			}
+		}
+		v := &NodeVerdict{
+			Node:       fields["node"],
+			Kernel:     fields["kernel"],
+			Source:     fields["source"],
+			BPF:        fields["bpf"],
+			BPFSyscall: fields["bpf_syscall"],
+			BTF:        fields["btf"],
+			VMLinux:    fields["vmlinux"],
+		}
+		v.evaluate()
+		return v, true
+	}
+	return nil, false
+}
+
+func buildDaemonSet(image string) *appsv1.DaemonSet {
+	labels := map[string]string{"app": daemonSetName}
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   daemonSetName,
+			Labels: labels,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					// node-agent runs on every Linux node, including tainted ones
+					NodeSelector:                  map[string]string{"kubernetes.io/os": "linux"},
+					Tolerations:                   []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+					TerminationGracePeriodSeconds: new(int64),
+					Containers: []corev1.Container{
+						{
+							Name:    daemonSetName,
+							Image:   image,
+							Command: []string{"/bin/sh", "-c", checkScript},
+							Env: []corev1.EnvVar{
+								{
+									Name: "NODE_NAME",
+									ValueFrom: &corev1.EnvVarSource{
+										FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+									},
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "boot", MountPath: "/host/boot", ReadOnly: true},
+							},
+							ReadinessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									Exec: &corev1.ExecAction{Command: []string{"/bin/sh", "-c", "test -f /tmp/ready"}},
+								},
+								InitialDelaySeconds: 1,
+								PeriodSeconds:       2,
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("10m"),
+									corev1.ResourceMemory: resource.MustParse("16Mi"),
+								},
+								Limits: corev1.ResourceList{
+									corev1.ResourceMemory: resource.MustParse("64Mi"),
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "boot",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{Path: "/boot"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// deployDaemonSet creates the check DaemonSet, replacing a leftover from an interrupted run.
+func deployDaemonSet(ctx context.Context, clientset *kubernetes.Clientset, namespace, image string) error {
+	dsClient := clientset.AppsV1().DaemonSets(namespace)
+	_, err := dsClient.Create(ctx, buildDaemonSet(image), metav1.CreateOptions{})
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	log.Printf("Removing leftover DaemonSet %s/%s from a previous run", namespace, daemonSetName)
+	if err := deleteDaemonSet(ctx, clientset, namespace); err != nil {
+		return err
+	}
+	err = wait.PollImmediate(2*time.Second, 60*time.Second, func() (bool, error) {
+		_, getErr := dsClient.Get(ctx, daemonSetName, metav1.GetOptions{})
+		return apierrors.IsNotFound(getErr), nil
+	})
+	if err != nil {
+		return fmt.Errorf("leftover DaemonSet was not removed: %w", err)
+	}
+	_, err = dsClient.Create(ctx, buildDaemonSet(image), metav1.CreateOptions{})
+	return err
+}
+
+func deleteDaemonSet(ctx context.Context, clientset *kubernetes.Clientset, namespace string) error {
+	propagation := metav1.DeletePropagationForeground
+	err := clientset.AppsV1().DaemonSets(namespace).Delete(ctx, daemonSetName, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// waitForPods waits until every scheduled pod is ready. A timeout is not an error:
+// nodes whose pod never became ready are reported as unverified.
+func waitForPods(ctx context.Context, clientset *kubernetes.Clientset, namespace string, timeout time.Duration) {
+	err := wait.PollImmediate(3*time.Second, timeout, func() (bool, error) {
+		ds, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, daemonSetName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		st := ds.Status
+		return st.DesiredNumberScheduled > 0 && st.NumberReady == st.DesiredNumberScheduled, nil
+	})
+	if err != nil {
+		log.Printf("eBPF check: not all DaemonSet pods became ready: %v", err)
+	}
+}
+
+// podStatusDetail explains why a pod did not report a verdict.
+func podStatusDetail(pod *corev1.Pod) string {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+			return fmt.Sprintf("pod %s: %s %s", pod.Name, cs.State.Waiting.Reason, cs.State.Waiting.Message)
+		}
+	}
+	return fmt.Sprintf("pod %s is %s", pod.Name, pod.Status.Phase)
+}
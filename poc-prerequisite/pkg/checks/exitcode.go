@@ -0,0 +1,68 @@
+package checks
+
+import (
+	"fmt"
+
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
+)
+
+// Process exit codes. 1 is left to log.Fatal for runtime errors.
+const (
+	ExitCodeOK    = 0
+	ExitCodeWarn  = 2 // worst check result is a warning
+	ExitCodeFail  = 3 // worst check result is a failure
+	ExitCodeError = 4 // at least one check could not complete
+)
+
+// FailOn is the lowest check status that makes the process exit non-zero.
+type FailOn string
+
+const (
+	FailOnNone FailOn = "none"
+	FailOnWarn FailOn = "warn"
+	FailOnFail FailOn = "fail"
+)
+
+func ParseFailOn(value string) (FailOn, error) {
+	switch f := FailOn(value); f {
+	case FailOnNone, FailOnWarn, FailOnFail:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid --fail-on value %q (expected none, warn or fail)", value)
+	}
+}
+
+// WorstStatus returns the most severe status among the results; skipped checks count as passed.
+func WorstStatus(results []common.CheckResult) common.CheckStatus {
+	return common.WorstStatus(results)
+}
+
+// ExitCode maps the worst check status to a process exit code,
+// returning ExitCodeOK when it is below the failOn threshold.
+func ExitCode(results []common.CheckResult, failOn FailOn) int {
+	worst := WorstStatus(results)
+
+	switch failOn {
+	case FailOnNone:
+		return ExitCodeOK
+	case FailOnFail:
+		if worst.Rank() < common.StatusFail.Rank() {
+			return ExitCodeOK
+		}
+	case FailOnWarn:
+		if worst.Rank() < common.StatusWarn.Rank() {
+			return ExitCodeOK
+		}
+	}
+
+	switch worst {
+	case common.StatusError:
+		return ExitCodeError
+	case common.StatusFail:
+		return ExitCodeFail
+	case common.StatusWarn:
+		return ExitCodeWarn
+	default:
+		return ExitCodeOK
+	}
+}
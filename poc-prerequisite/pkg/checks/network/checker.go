@@ -0,0 +1,299 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ProbeImageRepository is the published checker image the probe pod runs by default.
+	ProbeImageRepository  = "quay.io/danvid/kubescape-prerequisite"
+	DefaultProbeNamespace = "default"
+
+	// ProbeFlag is the command-line flag that switches the checker binary into probe mode.
+	ProbeFlag = "network-probe"
+
+	podWaitTimeout = 3 * time.Minute
+	// maxLogExcerpt bounds the probe pod log quoted in an error reason.
+	maxLogExcerpt = 512
+)
+
+// ImageTag selects the default probe image. The image workflow sets it to the commit tag it
+// pushes, with -ldflags "-X <package>.ImageTag=<tag>", so a published binary probes with
+// itself; other builds use latest, the only other tag that is published.
+var ImageTag = "latest"
+
+var DefaultProbeImage = ProbeImageRepository + ":" + ImageTag
+
+// Options configures the probe pod.
+type Options struct {
+	// Image must contain the checker binary, which runs in probe mode inside the pod.
+	Image        string
+	Namespace    string
+	NodeSelector map[string]string
+	// EndpointsFile overrides the embedded endpoint list.
+	EndpointsFile string
+}
+
+// Checker verifies egress from the cluster to the ARMO endpoints by running a probe pod.
+type Checker struct {
+	opts Options
+}
+
+func NewChecker(opts Options) *Checker {
+	if opts.Image == "" {
+		opts.Image = DefaultProbeImage
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = DefaultProbeNamespace
+	}
+	return &Checker{opts: opts}
+}
+
+func (c *Checker) Name() string {
+	return "network-egress"
+}
+
+func (c *Checker) Description() string {
+	return "TCP and TLS connectivity from a cluster pod to the ARMO, Anchore and GitHub endpoints"
+}
+
+func (c *Checker) Type() common.CheckType {
+	return common.CheckTypeActive
+}
+
+func (c *Checker) Tags() []string {
+	return []string{"network"}
+}
+
+func (c *Checker) Run(ctx context.Context, clientset *kubernetes.Clientset, _ *common.ClusterData) *common.CheckResult {
+	endpoints, err := LoadEndpoints(c.opts.EndpointsFile)
+	if err != nil {
+		return &common.CheckResult{
+			Status:      common.StatusError,
+			Reason:      fmt.Sprintf("Could not load endpoints from %q: %v", c.opts.EndpointsFile, err),
+			Remediation: "Fix or remove the --network-endpoints-file option.",
+		}
+	}
+
+	results, podRef, err := c.runProbePod(ctx, clientset, endpoints)
+	if err != nil {
+		log.Printf("Network egress check could not complete: %v", err)
+		return &common.CheckResult{
+			Status:      common.StatusError,
+			Reason:      err.Error(),
+			Evidence:    []common.ObjectRef{podRef},
+			Remediation: "Make sure the probe image can be pulled and that the checker may create Pods and read their logs in the probe namespace.",
+		}
+	}
+
+	return buildResult(results)
+}
+
+// runProbePod starts the probe pod, waits for it to finish and parses its log.
+func (c *Checker) runProbePod(ctx context.Context, clientset *kubernetes.Clientset, endpoints []Endpoint) ([]EndpointResult, common.ObjectRef, error) {
+	podRef := common.ObjectRef{Kind: "Pod", Namespace: c.opts.Namespace}
+
+	encoded, err := json.Marshal(endpoints)
+	if err != nil {
+		return nil, podRef, err
+	}
+
+	pod, err := clientset.CoreV1().Pods(c.opts.Namespace).Create(ctx, c.probePod(string(encoded)), metav1.CreateOptions{})
+	if err != nil {
+		return nil, podRef, fmt.Errorf("failed to create probe pod: %w", err)
+	}
+	podRef.Name = pod.Name
+
+	defer func() {
+		if delErr := clientset.CoreV1().Pods(c.opts.Namespace).Delete(context.Background(), pod.Name, metav1.DeleteOptions{}); delErr != nil {
+			log.Printf("Warning: could not delete probe pod %s/%s: %v", c.opts.Namespace, pod.Name, delErr)
+		}
+	}()
+
+	var phaseDetail string
+	err = wait.PollImmediate(3*time.Second, podWaitTimeout, func() (bool, error) {
+		p, err := clientset.CoreV1().Pods(c.opts.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		phaseDetail = podStatusDetail(p)
+		return p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed, nil
+	})
+	if err != nil {
+		podRef.Detail = phaseDetail
+		return nil, podRef, fmt.Errorf("probe pod did not complete: %w", err)
+	}
+
+	logs, err := clientset.CoreV1().Pods(c.opts.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).DoRaw(ctx)
+	if err != nil {
+		return nil, podRef, fmt.Errorf("failed to read probe pod logs: %w", err)
+	}
+
+	results, err := parseProbeOutput(string(logs))
+	if err != nil {
+		podRef.Detail = phaseDetail
+		return nil, podRef, err
+	}
+	return results, podRef, nil
+}
+
+func (c *Checker) probePod(encodedEndpoints string) *corev1.Pod {
+	runAsNonRoot := true
+	allowEscalation := false
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "armo-network-check-",
+			Labels:       map[string]string{"app": "armo-network-check"},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			NodeSelector:  c.opts.NodeSelector,
+			Containers: []corev1.Container{
+				{
+					Name:  "armo-network-check",
+					Image: c.opts.Image,
+					Args:  []string{"--" + ProbeFlag},
+					Env: []corev1.EnvVar{
+						{Name: endpointsEnv, Value: encodedEndpoints},
+					},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("50m"),
+							corev1.ResourceMemory: resource.MustParse("32Mi"),
+						},
+						Limits: corev1.ResourceList{
+							corev1.ResourceMemory: resource.MustParse("64Mi"),
+						},
+					},
+					SecurityContext: &corev1.SecurityContext{
+						RunAsNonRoot:             &runAsNonRoot,
+						AllowPrivilegeEscalation: &allowEscalation,
+					},
+				},
+			},
+		},
+	}
+}
+
+func parseProbeOutput(logs string) ([]EndpointResult, error) {
+	var results []EndpointResult
+	scanner := bufio.NewScanner(strings.NewReader(logs))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, resultPrefix) {
+			continue
+		}
+		var res EndpointResult
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, resultPrefix)), &res); err != nil {
+			return nil, fmt.Errorf("could not parse probe output %q: %w", line, err)
+		}
+		results = append(results, res)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("probe pod produced no results, is the image a kubescape-prerequisite image? Log tail: %q", logTail(logs, maxLogExcerpt))
+	}
+	return results, nil
+}
+
+// logTail returns at most max bytes from the end of logs, starting on a line boundary when possible.
+func logTail(logs string, max int) string {
+	logs = strings.TrimSpace(logs)
+	if len(logs) <= max {
+		return logs
+	}
+	tail := logs[len(logs)-max:]
+	if i := strings.IndexByte(tail, '\n'); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
+	}
+	return "..." + strings.ToValidUTF8(tail, "")
+}
+
+func podStatusDetail(pod *corev1.Pod) string {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+			return fmt.Sprintf("%s: %s", cs.State.Waiting.Reason, cs.State.Waiting.Message)
+		}
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue && cond.Message != "" {
+			return fmt.Sprintf("%s: %s", cond.Reason, cond.Message)
+		}
+	}
+	return string(pod.Status.Phase)
+}
+
+// buildResult turns per-endpoint results into a check result:
+// any unreachable endpoint fails the check, untrusted TLS only warns.
+func buildResult(results []EndpointResult) *common.CheckResult {
+	table := &common.ResultTable{Columns: []string{"Region", "Endpoint", "TCP", "TLS", "Latency", "Error"}}
+	var failed, untrusted []common.ObjectRef
+	failedRegions := map[string]bool{}
+
+	for _, r := range results {
+		tcp := "ok"
+		if !r.TCP {
+			tcp = "failed"
+		}
+		latency := ""
+		if r.TCP {
+			latency = fmt.Sprintf("%dms", r.LatencyMs)
+		}
+		table.Rows = append(table.Rows, []string{r.Region, r.Address(), tcp, r.TLS, latency, r.Error})
+
+		ref := common.ObjectRef{Kind: "Endpoint", Name: r.Address(), Detail: fmt.Sprintf("%s: %s", r.Region, r.Error)}
+		switch {
+		case !r.TCP || r.TLS == TLSFailed:
+			failed = append(failed, ref)
+			failedRegions[r.Region] = true
+		case r.TLS == TLSUntrusted:
+			untrusted = append(untrusted, ref)
+		}
+	}
+
+	switch {
+	case len(failed) > 0:
+		var regions []string
+		for _, r := range results {
+			if failedRegions[r.Region] {
+				regions = append(regions, r.Region)
+				delete(failedRegions, r.Region)
+			}
+		}
+		return &common.CheckResult{
+			Status:      common.StatusFail,
+			Severity:    common.SeverityHigh,
+			Reason:      fmt.Sprintf("%d of %d endpoints are not reachable on TCP/TLS (regions: %s).", len(failed), len(results), strings.Join(regions, ", ")),
+			Evidence:    append(failed, untrusted...),
+			Remediation: "Allow egress on TCP 443 from the cluster nodes (firewall, security groups, NetworkPolicies, proxy) to the listed endpoints.",
+			Details:     table,
+		}
+	case len(untrusted) > 0:
+		return &common.CheckResult{
+			Status:      common.StatusWarn,
+			Severity:    common.SeverityMedium,
+			Reason:      fmt.Sprintf("%d endpoints present a certificate that does not verify, likely due to TLS inspection.", len(untrusted)),
+			Evidence:    untrusted,
+			Remediation: "Exclude the ARMO endpoints from TLS inspection, or configure the Kubescape components to trust the proxy CA.",
+			Details:     table,
+		}
+	default:
+		return &common.CheckResult{
+			Status:  common.StatusPass,
+			Reason:  fmt.Sprintf("All %d endpoints are reachable.", len(results)),
+			Details: table,
+		}
+	}
+}
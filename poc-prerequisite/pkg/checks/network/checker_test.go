@@ -0,0 +1,34 @@
+package network
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseProbeOutputTruncatesLog(t *testing.T) {
+	logs := strings.Repeat("exec format error\n", 200) + "last line"
+
+	_, err := parseProbeOutput(logs)
+	if err == nil {
+		t.Fatal("expected an error for a log without results")
+	}
+	if len(err.Error()) > 2*maxLogExcerpt {
+		t.Errorf("error embeds %d bytes of log, want at most about %d", len(err.Error()), maxLogExcerpt)
+	}
+	if !strings.Contains(err.Error(), "last line") {
+		t.Errorf("error %q does not keep the end of the log", err)
+	}
+}
+
+func TestParseProbeOutput(t *testing.T) {
+	logs := "starting\n" +
+		resultPrefix + `{"host":"api.armosec.io","port":443,"region":"eu","tcp":true,"tls":"ok","latencyMs":12}` + "\n"
+
+	results, err := parseProbeOutput(logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Host != "api.armosec.io" || !results[0].TCP {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
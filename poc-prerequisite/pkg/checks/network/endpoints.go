@@ -0,0 +1,97 @@
+package network
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPort   = 443
+	defaultRegion = "Custom"
+)
+
+//go:embed endpoints.txt
+var defaultEndpoints string
+
+// Endpoint is a host (name or IP) the cluster must reach, grouped by region.
+type Endpoint struct {
+	Region string `json:"region"`
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+}
+
+func (e Endpoint) Address() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// IsIP reports whether the endpoint is a raw IP, for which TLS is not verified.
+func (e Endpoint) IsIP() bool {
+	return net.ParseIP(e.Host) != nil
+}
+
+// DefaultEndpoints returns the embedded ARMO endpoint list.
+func DefaultEndpoints() []Endpoint {
+	endpoints, err := ParseEndpoints(strings.NewReader(defaultEndpoints))
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded endpoint list: %v", err))
+	}
+	return endpoints
+}
+
+// LoadEndpoints reads an endpoint list from a file, or returns the embedded list when path is empty.
+func LoadEndpoints(path string) ([]Endpoint, error) {
+	if path == "" {
+		return DefaultEndpoints(), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseEndpoints(f)
+}
+
+// ParseEndpoints parses the endpoints.txt format: "[Region]" headers followed by
+// "host" or "host:port" lines. Blank lines and "#" comments are ignored, so the
+// bash script's ip_list.txt is accepted as well (all entries in region "Custom").
+func ParseEndpoints(r io.Reader) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	region := defaultRegion
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			region = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		ep := Endpoint{Region: region, Host: line, Port: defaultPort}
+		if host, port, err := net.SplitHostPort(line); err == nil {
+			p, err := strconv.Atoi(port)
+			if err != nil || p <= 0 || p > 65535 {
+				return nil, fmt.Errorf("line %d: invalid port in %q", lineNo, line)
+			}
+			ep.Host, ep.Port = host, p
+		}
+		endpoints = append(endpoints, ep)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no endpoints found")
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,122 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// endpointsEnv carries the JSON encoded endpoint list into the probe pod.
+	endpointsEnv = "ARMO_NETWORK_PROBE_ENDPOINTS"
+	// resultPrefix marks probe result lines in the pod log.
+	resultPrefix = "ARMO-NETWORK-PROBE "
+
+	probeTimeout = 5 * time.Second
+	probeWorkers = 8
+)
+
+// TLS handshake outcomes.
+const (
+	TLSOK        = "ok"
+	TLSUntrusted = "untrusted" // handshake works but the certificate does not verify (e.g. TLS inspection proxy)
+	TLSFailed    = "failed"
+	TLSNotTested = "n/a" // raw IPs or unreachable endpoints
+)
+
+// EndpointResult is the outcome of probing one endpoint.
+type EndpointResult struct {
+	Endpoint
+	TCP       bool   `json:"tcp"`
+	TLS       string `json:"tls"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// RunProbe is the entrypoint of the probe pod: it reads the endpoints from the
+// environment, probes them and writes one result line per endpoint to out.
+func RunProbe(out io.Writer) error {
+	var endpoints []Endpoint
+	if err := json.Unmarshal([]byte(os.Getenv(endpointsEnv)), &endpoints); err != nil {
+		return fmt.Errorf("could not decode %s: %w", endpointsEnv, err)
+	}
+
+	for _, res := range ProbeEndpoints(context.Background(), endpoints) {
+		line, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s%s\n", resultPrefix, line)
+	}
+	return nil
+}
+
+// ProbeEndpoints checks TCP reachability and the TLS handshake of every endpoint
+// concurrently and returns the results in input order.
+func ProbeEndpoints(ctx context.Context, endpoints []Endpoint) []EndpointResult {
+	results := make([]EndpointResult, len(endpoints))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < probeWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = probeEndpoint(ctx, endpoints[i])
+			}
+		}()
+	}
+	for i := range endpoints {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func probeEndpoint(ctx context.Context, ep Endpoint) EndpointResult {
+	res := EndpointResult{Endpoint: ep, TLS: TLSNotTested}
+
+	dialer := &net.Dialer{Timeout: probeTimeout}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", ep.Address())
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.TCP = true
+	res.LatencyMs = time.Since(start).Milliseconds()
+
+	// Without a hostname there is no SNI or certificate name to verify.
+	if ep.IsIP() {
+		conn.Close()
+		return res
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(probeTimeout))
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: ep.Host})
+	err = tlsConn.HandshakeContext(ctx)
+	tlsConn.Close()
+
+	var verifyErr *tls.CertificateVerificationError
+	switch {
+	case err == nil:
+		res.TLS = TLSOK
+	case errors.As(err, &verifyErr):
+		res.TLS = TLSUntrusted
+		res.Error = err.Error()
+	default:
+		res.TLS = TLSFailed
+		res.Error = err.Error()
+	}
+	return res
+}
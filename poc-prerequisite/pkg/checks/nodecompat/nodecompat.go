@@ -0,0 +1,194 @@
+package nodecompat
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultMinKernelVersion is the oldest kernel node-agent supports.
+const DefaultMinKernelVersion = "5.4"
+
+// supportedArchitectures are the architectures node-agent images are published for.
+var supportedArchitectures = map[string]bool{
+	"amd64": true,
+	"arm64": true,
+}
+
+var kernelVersionRe = regexp.MustCompile(`^(\d+)\.(\d+)`)
+
+// Options configures the compatibility thresholds.
+type Options struct {
+	MinKernelVersion string
+}
+
+// Checker evaluates the NodeInfo reported by the kubelet of every node
+// against what node-agent can run on, without deploying anything.
+type Checker struct {
+	opts Options
+}
+
+func NewChecker(opts Options) *Checker {
+	if opts.MinKernelVersion == "" {
+		opts.MinKernelVersion = DefaultMinKernelVersion
+	}
+	return &Checker{opts: opts}
+}
+
+func (c *Checker) Name() string {
+	return "node-compatibility"
+}
+
+func (c *Checker) Description() string {
+	return "Node kernel version, operating system and architecture supported by node-agent"
+}
+
+func (c *Checker) Type() common.CheckType {
+	return common.CheckTypePassive
+}
+
+func (c *Checker) Tags() []string {
+	return []string{"ebpf", "node"}
+}
+
+// nodeIssue is a single incompatibility found on a node.
+type nodeIssue struct {
+	status common.CheckStatus
+	reason string
+}
+
+func (c *Checker) Run(_ context.Context, _ *kubernetes.Clientset, clusterData *common.ClusterData) *common.CheckResult {
+	if clusterData == nil || len(clusterData.Nodes) == 0 {
+		return &common.CheckResult{
+			Status: common.StatusSkip,
+			Reason: "no node data collected",
+		}
+	}
+
+	minMajor, minMinor, ok := parseKernelVersion(c.opts.MinKernelVersion)
+	if !ok {
+		return &common.CheckResult{
+			Status:      common.StatusError,
+			Reason:      fmt.Sprintf("Invalid minimum kernel version %q", c.opts.MinKernelVersion),
+			Remediation: "Pass a version such as 5.4 to --min-kernel-version.",
+		}
+	}
+
+	nodes := append([]corev1.Node(nil), clusterData.Nodes...)
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	table := &common.ResultTable{Columns: []string{"Node", "Node pool", "OS", "OS image", "Architecture", "Kernel", "Verdict"}}
+	var evidence []common.ObjectRef
+	// Warnings are either nodes node-agent does not run on, or Linux nodes whose kernel is unknown
+	var failCount, nonLinuxCount, unknownKernelCount int
+
+	for _, node := range nodes {
+		ni := node.Status.NodeInfo
+		issues := c.evaluate(ni, minMajor, minMinor)
+
+		verdict := "compatible"
+		var reasons []string
+		worst := common.StatusPass
+		for _, issue := range issues {
+			reasons = append(reasons, issue.reason)
+			if issue.status == common.StatusFail || worst == common.StatusPass {
+				worst = issue.status
+			}
+		}
+		switch worst {
+		case common.StatusFail:
+			failCount++
+			verdict = "incompatible: " + strings.Join(reasons, "; ")
+		case common.StatusWarn:
+			if ni.OperatingSystem != "linux" {
+				nonLinuxCount++
+			} else {
+				unknownKernelCount++
+			}
+			verdict = "warning: " + strings.Join(reasons, "; ")
+		}
+		if worst != common.StatusPass {
+			evidence = append(evidence, common.ObjectRef{Kind: "Node", Name: node.Name, Detail: strings.Join(reasons, "; ")})
+		}
+
+		pool := common.NodePool(node)
+		if pool == "" {
+			pool = "-"
+		}
+		table.Rows = append(table.Rows, []string{node.Name, pool, ni.OperatingSystem, ni.OSImage, ni.Architecture, ni.KernelVersion, verdict})
+	}
+
+	switch {
+	case failCount > 0:
+		return &common.CheckResult{
+			Status:      common.StatusFail,
+			Severity:    common.SeverityHigh,
+			Reason:      fmt.Sprintf("%d of %d nodes cannot run node-agent (kernel older than %s or unsupported architecture).", failCount, len(nodes), c.opts.MinKernelVersion),
+			Evidence:    evidence,
+			Remediation: fmt.Sprintf("Upgrade the node image of the listed nodes to a kernel %s or newer on amd64/arm64, or keep node-agent off them with a nodeSelector/affinity.", c.opts.MinKernelVersion),
+			Details:     table,
+		}
+	case nonLinuxCount > 0 || unknownKernelCount > 0:
+		var reasons, remediations []string
+		if nonLinuxCount > 0 {
+			reasons = append(reasons, fmt.Sprintf("node-agent will not run on %d of %d nodes, which do not run Linux; runtime detection will not cover them.", nonLinuxCount, len(nodes)))
+			remediations = append(remediations, "Runtime threat detection and reachability analysis are only available on Linux nodes; the rest of Kubescape is unaffected.")
+		}
+		if unknownKernelCount > 0 {
+			reasons = append(reasons, fmt.Sprintf("The kernel version of %d of %d Linux nodes is not recognized, so kernel %s or newer could not be confirmed.", unknownKernelCount, len(nodes), c.opts.MinKernelVersion))
+			remediations = append(remediations, fmt.Sprintf("Check with `uname -r` on the listed nodes that the kernel is %s or newer; node-agent fails to start on older kernels.", c.opts.MinKernelVersion))
+		}
+		return &common.CheckResult{
+			Status:      common.StatusWarn,
+			Severity:    common.SeverityLow,
+			Reason:      strings.Join(reasons, " "),
+			Evidence:    evidence,
+			Remediation: strings.Join(remediations, " "),
+			Details:     table,
+		}
+	default:
+		return &common.CheckResult{
+			Status:  common.StatusPass,
+			Reason:  fmt.Sprintf("All %d nodes run Linux on a supported architecture with kernel %s or newer.", len(nodes), c.opts.MinKernelVersion),
+			Details: table,
+		}
+	}
+}
+
+func (c *Checker) evaluate(ni corev1.NodeSystemInfo, minMajor, minMinor int) []nodeIssue {
+	if ni.OperatingSystem != "linux" {
+		return []nodeIssue{{common.StatusWarn, fmt.Sprintf("%s nodes are not supported by node-agent", ni.OperatingSystem)}}
+	}
+
+	var issues []nodeIssue
+	if !supportedArchitectures[ni.Architecture] {
+		issues = append(issues, nodeIssue{common.StatusFail, fmt.Sprintf("architecture %s is not supported", ni.Architecture)})
+	}
+
+	major, minor, ok := parseKernelVersion(ni.KernelVersion)
+	switch {
+	case !ok:
+		issues = append(issues, nodeIssue{common.StatusWarn, fmt.Sprintf("unrecognized kernel version %q", ni.KernelVersion)})
+	case major < minMajor || (major == minMajor && minor < minMinor):
+		issues = append(issues, nodeIssue{common.StatusFail, fmt.Sprintf("kernel %s is older than %s", ni.KernelVersion, c.opts.MinKernelVersion)})
+	}
+	return issues
+}
+
+// parseKernelVersion extracts major.minor from strings such as "5.10.209-198.858.amzn2.x86_64".
+func parseKernelVersion(version string) (int, int, bool) {
+	m := kernelVersionRe.FindStringSubmatch(strings.TrimSpace(version))
+	if m == nil {
+		return 0, 0, false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return major, minor, true
+}
@@ -0,0 +1,76 @@
+package nodecompat
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func node(name, os, kernel string) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{
+			OperatingSystem: os,
+			Architecture:    "amd64",
+			KernelVersion:   kernel,
+		}},
+	}
+}
+
+func TestRunWarnings(t *testing.T) {
+	tests := []struct {
+		name            string
+		nodes           []corev1.Node
+		wantReason      []string
+		wantRemediation []string
+		notInReason     []string
+	}{
+		{
+			name:            "windows node",
+			nodes:           []corev1.Node{node("a", "linux", "5.15.0"), node("b", "windows", "10.0.17763")},
+			wantReason:      []string{"will not run on 1 of 2 nodes"},
+			wantRemediation: []string{"only available on Linux nodes"},
+			notInReason:     []string{"not recognized"},
+		},
+		{
+			name:            "unrecognized kernel",
+			nodes:           []corev1.Node{node("a", "linux", "5.15.0"), node("b", "linux", "custom")},
+			wantReason:      []string{"kernel version of 1 of 2 Linux nodes is not recognized"},
+			wantRemediation: []string{"uname -r"},
+			notInReason:     []string{"will not run"},
+		},
+		{
+			name:            "both",
+			nodes:           []corev1.Node{node("a", "windows", "10.0"), node("b", "linux", "custom")},
+			wantReason:      []string{"will not run on 1 of 2 nodes", "1 of 2 Linux nodes is not recognized"},
+			wantRemediation: []string{"only available on Linux nodes", "uname -r"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := NewChecker(Options{}).Run(context.Background(), nil, &common.ClusterData{Nodes: tt.nodes})
+			if result.Status != common.StatusWarn {
+				t.Fatalf("status %s, want warn: %s", result.Status, result.Reason)
+			}
+			for _, want := range tt.wantReason {
+				if !strings.Contains(result.Reason, want) {
+					t.Errorf("reason %q does not contain %q", result.Reason, want)
+				}
+			}
+			for _, unwanted := range tt.notInReason {
+				if strings.Contains(result.Reason, unwanted) {
+					t.Errorf("reason %q contains %q", result.Reason, unwanted)
+				}
+			}
+			for _, want := range tt.wantRemediation {
+				if !strings.Contains(result.Remediation, want) {
+					t.Errorf("remediation %q does not contain %q", result.Remediation, want)
+				}
+			}
+		})
+	}
+}
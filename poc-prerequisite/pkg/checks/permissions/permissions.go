@@ -0,0 +1,243 @@
+package permissions
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultNamespace is the namespace the kubescape-operator chart is usually installed into.
+const DefaultNamespace = "kubescape"
+
+// installVerbs are needed on every kind for helm install and helm upgrade:
+// upgrades patch or update changed objects and delete removed ones.
+var installVerbs = []string{"create", "update", "patch", "delete"}
+
+// requirement is a resource kind the kubescape-operator chart creates.
+type requirement struct {
+	Group      string
+	Resource   string
+	Namespaced bool
+	// Extra lists verbs needed on top of installVerbs.
+	Extra []string
+}
+
+// chartRequirements lists every kind rendered by the kubescape-operator chart,
+// plus the Secrets Helm uses to store the release.
+//
+// Creating a (Cluster)Role with permissions the identity does not hold needs
+// escalate on it, and creating a (Cluster)RoleBinding to such a role needs bind
+// on the role; without them RBAC creation fails for identities that are not
+// cluster-admin.
+var chartRequirements = []requirement{
+	// cluster-scoped
+	{Group: "", Resource: "namespaces"},
+	{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"},
+	{Group: "rbac.authorization.k8s.io", Resource: "clusterroles", Extra: []string{"escalate", "bind"}},
+	{Group: "rbac.authorization.k8s.io", Resource: "clusterrolebindings"},
+	{Group: "admissionregistration.k8s.io", Resource: "validatingwebhookconfigurations"},
+	{Group: "admissionregistration.k8s.io", Resource: "mutatingwebhookconfigurations"},
+	{Group: "apiregistration.k8s.io", Resource: "apiservices"},
+	{Group: "scheduling.k8s.io", Resource: "priorityclasses"},
+
+	// namespaced
+	{Group: "", Resource: "serviceaccounts", Namespaced: true},
+	{Group: "", Resource: "configmaps", Namespaced: true},
+	{Group: "", Resource: "secrets", Namespaced: true},
+	{Group: "", Resource: "services", Namespaced: true},
+	{Group: "", Resource: "persistentvolumeclaims", Namespaced: true},
+	{Group: "rbac.authorization.k8s.io", Resource: "roles", Namespaced: true, Extra: []string{"escalate", "bind"}},
+	{Group: "rbac.authorization.k8s.io", Resource: "rolebindings", Namespaced: true},
+	{Group: "apps", Resource: "deployments", Namespaced: true},
+	{Group: "apps", Resource: "statefulsets", Namespaced: true},
+	{Group: "apps", Resource: "daemonsets", Namespaced: true},
+	{Group: "batch", Resource: "cronjobs", Namespaced: true},
+	{Group: "batch", Resource: "jobs", Namespaced: true},
+	{Group: "networking.k8s.io", Resource: "networkpolicies", Namespaced: true},
+}
+
+func (r requirement) Verbs() []string {
+	return append(append([]string{}, installVerbs...), r.Extra...)
+}
+
+func (r requirement) String() string {
+	if r.Group == "" {
+		return r.Resource
+	}
+	return r.Group + "/" + r.Resource
+}
+
+// Options configures the target of the Helm installation.
+type Options struct {
+	Namespace string
+}
+
+// Checker verifies, through a SelfSubjectRulesReview and SelfSubjectAccessReviews,
+// that the current identity may install and upgrade the kubescape-operator Helm chart.
+type Checker struct {
+	opts Options
+}
+
+func NewChecker(opts Options) *Checker {
+	if opts.Namespace == "" {
+		opts.Namespace = DefaultNamespace
+	}
+	return &Checker{opts: opts}
+}
+
+func (c *Checker) Name() string {
+	return "helm-permissions"
+}
+
+func (c *Checker) Description() string {
+	return "Permission of the current identity to install the kubescape-operator Helm chart"
+}
+
+func (c *Checker) Type() common.CheckType {
+	return common.CheckTypePassive
+}
+
+func (c *Checker) Tags() []string {
+	return []string{"rbac", "helm"}
+}
+
+func (c *Checker) Run(ctx context.Context, clientset *kubernetes.Clientset, _ *common.ClusterData) *common.CheckResult {
+	if clientset == nil {
+		return &common.CheckResult{
+			Status: common.StatusSkip,
+			Reason: "requires cluster access",
+		}
+	}
+
+	identity := currentIdentity(ctx, clientset)
+
+	// One SelfSubjectRulesReview answers for the namespaced kinds, unless the
+	// authorizer cannot enumerate every rule (e.g. webhook authorizers).
+	rules, err := namespaceRules(ctx, clientset, c.opts.Namespace)
+	if err != nil {
+		log.Printf("SelfSubjectRulesReview in namespace %q failed, falling back to access reviews: %v", c.opts.Namespace, err)
+	}
+
+	table := &common.ResultTable{Columns: []string{"Resource", "Namespace", "Allowed", "Missing", "Reason"}}
+	var missing []common.ObjectRef
+	var missingNames []string
+	total := 0
+
+	for _, req := range chartRequirements {
+		scope := "(cluster)"
+		namespace := ""
+		if req.Namespaced {
+			namespace = c.opts.Namespace
+			scope = namespace
+		}
+
+		var allowedVerbs, missingVerbs, reasons []string
+		for _, verb := range req.Verbs() {
+			total++
+			allowed, reason := false, ""
+			if req.Namespaced && rules != nil && rulesAllow(rules, req.Group, req.Resource, verb) {
+				allowed = true
+			} else {
+				review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+					Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Verb:      verb,
+						Group:     req.Group,
+						Resource:  req.Resource,
+						Namespace: namespace,
+					}},
+				}, metav1.CreateOptions{})
+				if err != nil {
+					return &common.CheckResult{
+						Status:      common.StatusError,
+						Reason:      fmt.Sprintf("SelfSubjectAccessReview for %s %s failed: %v", verb, req, err),
+						Remediation: "SelfSubjectAccessReviews are allowed for every authenticated user by default; check that the API server exposes authorization.k8s.io/v1.",
+					}
+				}
+				allowed, reason = review.Status.Allowed, review.Status.Reason
+			}
+
+			if allowed {
+				allowedVerbs = append(allowedVerbs, verb)
+				continue
+			}
+			missingVerbs = append(missingVerbs, verb)
+			if reason != "" {
+				reasons = append(reasons, reason)
+			}
+			missing = append(missing, common.ObjectRef{Kind: req.String(), Namespace: namespace, Name: fmt.Sprintf("%s %s", verb, req), Detail: reason})
+			missingNames = append(missingNames, fmt.Sprintf("%s %s", verb, req))
+		}
+		table.Rows = append(table.Rows, []string{req.String(), scope, strings.Join(allowedVerbs, ","), strings.Join(missingVerbs, ","), strings.Join(reasons, "; ")})
+	}
+
+	if len(missing) > 0 {
+		return &common.CheckResult{
+			Status:   common.StatusFail,
+			Severity: common.SeverityCritical,
+			Reason: fmt.Sprintf("%s is missing %d of %d permissions needed to install and upgrade the chart into namespace %q: %s.",
+				identity, len(missing), total, c.opts.Namespace, strings.Join(missingNames, ", ")),
+			Evidence:    missing,
+			Remediation: fmt.Sprintf("Grant %s a (Cluster)Role with the listed permissions, or run the installation with a cluster-admin identity.", identity),
+			Details:     table,
+		}
+	}
+	return &common.CheckResult{
+		Status:  common.StatusPass,
+		Reason:  fmt.Sprintf("%s may install and upgrade all %d kinds of the chart into namespace %q.", identity, len(chartRequirements), c.opts.Namespace),
+		Details: table,
+	}
+}
+
+// namespaceRules returns the rules the current identity holds in namespace, or
+// nil when the review is incomplete and access reviews must decide.
+func namespaceRules(ctx context.Context, clientset *kubernetes.Clientset, namespace string) ([]authorizationv1.ResourceRule, error) {
+	review, err := clientset.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx, &authorizationv1.SelfSubjectRulesReview{
+		Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: namespace},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if review.Status.Incomplete {
+		return nil, nil
+	}
+	return review.Status.ResourceRules, nil
+}
+
+// rulesAllow reports whether any rule grants verb on every object of group/resource.
+// Rules restricted to resource names do not count, as the chart names its own objects.
+func rulesAllow(rules []authorizationv1.ResourceRule, group, resource, verb string) bool {
+	for _, rule := range rules {
+		if len(rule.ResourceNames) > 0 {
+			continue
+		}
+		if matches(rule.APIGroups, group) && matches(rule.Resources, resource) && matches(rule.Verbs, verb) {
+			return true
+		}
+	}
+	return false
+}
+
+func matches(values []string, want string) bool {
+	for _, v := range values {
+		if v == "*" || v == want {
+			return true
+		}
+	}
+	return false
+}
+
+// currentIdentity names the user the checker runs as, when the cluster supports SelfSubjectReview.
+func currentIdentity(ctx context.Context, clientset *kubernetes.Clientset) string {
+	review, err := clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err != nil || review.Status.UserInfo.Username == "" {
+		return "The current identity"
+	}
+	return fmt.Sprintf("User %q", review.Status.UserInfo.Username)
+}
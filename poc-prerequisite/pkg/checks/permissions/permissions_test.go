@@ -0,0 +1,54 @@
+package permissions
+
+import (
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+func TestRulesAllow(t *testing.T) {
+	rules := []authorizationv1.ResourceRule{
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"create", "patch"}},
+		{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"*"}, ResourceNames: []string{"kubescape-config"}},
+		{APIGroups: []string{"batch"}, Resources: []string{"*"}, Verbs: []string{"*"}},
+	}
+
+	tests := []struct {
+		name                  string
+		group, resource, verb string
+		want                  bool
+	}{
+		{"listed verb", "apps", "deployments", "patch", true},
+		{"unlisted verb", "apps", "deployments", "delete", false},
+		{"other group", "extensions", "deployments", "create", false},
+		{"resource names only", "", "configmaps", "create", false},
+		{"wildcards", "batch", "cronjobs", "update", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rulesAllow(rules, tt.group, tt.resource, tt.verb); got != tt.want {
+				t.Errorf("rulesAllow(%s %s/%s) = %v, want %v", tt.verb, tt.group, tt.resource, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequirementVerbs(t *testing.T) {
+	for _, req := range chartRequirements {
+		if req.Resource != "clusterroles" {
+			continue
+		}
+		verbs := req.Verbs()
+		want := []string{"create", "update", "patch", "delete", "escalate", "bind"}
+		if len(verbs) != len(want) {
+			t.Fatalf("clusterroles verbs = %v, want %v", verbs, want)
+		}
+		for i := range want {
+			if verbs[i] != want[i] {
+				t.Fatalf("clusterroles verbs = %v, want %v", verbs, want)
+			}
+		}
+		return
+	}
+	t.Fatal("clusterroles missing from chartRequirements")
+}
@@ -0,0 +1,83 @@
+package pvcheck
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Options configures how the PV provisioning check covers the cluster.
+type Options struct {
+	// Mode is ModeSingle (default), ModeZone or ModeNodePool.
+	Mode string
+	// StorageClass is tested instead of the cluster default when set.
+	StorageClass string
+	// AllStorageClasses tests every dynamic StorageClass.
+	AllStorageClasses bool
+}
+
+// Checker exposes the PV provisioning check through the common.Checker interface.
+type Checker struct {
+	opts Options
+}
+
+func NewChecker(opts Options) *Checker {
+	if opts.Mode == "" {
+		opts.Mode = ModeSingle
+	}
+	return &Checker{opts: opts}
+}
+
+func (c *Checker) Name() string {
+	return "pv-provisioning"
+}
+
+func (c *Checker) Description() string {
+	return "Dynamic PersistentVolume provisioning with the StorageClass used by the Kubescape storage component"
+}
+
+func (c *Checker) Type() common.CheckType {
+	return common.CheckTypeActive
+}
+
+func (c *Checker) Tags() []string {
+	return []string{"storage"}
+}
+
+func (c *Checker) Run(ctx context.Context, clientset *kubernetes.Clientset, clusterData *common.ClusterData) *common.CheckResult {
+	pvResult := RunPVProvisioningCheck(ctx, clientset, clusterData, c.opts)
+	result := &common.CheckResult{
+		Status:      pvResult.Status,
+		Reason:      pvResult.Reason,
+		Evidence:    pvResult.Evidence,
+		Remediation: pvResult.Remediation,
+	}
+
+	if pvResult.RecommendedStorageClass != "" {
+		result.RecommendedValues = map[string]string{"storage.storageClass": pvResult.RecommendedStorageClass}
+	}
+
+	if len(pvResult.Groups) > 1 || c.opts.Mode != ModeSingle || c.opts.AllStorageClasses {
+		table := &common.ResultTable{Columns: []string{
+			"StorageClass", "Binding mode", "Group", "Group nodes", "Test pod node", "Result", "Bind latency", "Duration", "Reason",
+		}}
+		for _, g := range pvResult.Groups {
+			verdict, bindLatency := "passed", ""
+			if !g.Passed {
+				verdict = "failed"
+			}
+			if g.BindLatency > 0 {
+				bindLatency = g.BindLatency.Round(100 * time.Millisecond).String()
+			}
+			table.Rows = append(table.Rows, []string{
+				g.StorageClass, g.BindingMode, g.Group, fmt.Sprint(g.NodeCount), g.Node, verdict,
+				bindLatency, g.Duration.Round(100 * time.Millisecond).String(), g.Reason,
+			})
+		}
+		result.Details = table
+	}
+	return result
+}
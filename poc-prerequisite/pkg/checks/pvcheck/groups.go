@@ -0,0 +1,141 @@
+package pvcheck
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Provisioning modes: one test for the whole cluster, or one per zone / node pool.
+const (
+	ModeSingle   = "single"
+	ModeZone     = "zone"
+	ModeNodePool = "node-pool"
+)
+
+const (
+	zoneLabel       = "topology.kubernetes.io/zone"
+	legacyZoneLabel = "failure-domain.beta.kubernetes.io/zone"
+)
+
+// ParseMode validates a --pv-check-mode value.
+func ParseMode(mode string) (string, error) {
+	switch mode {
+	case ModeSingle, ModeZone, ModeNodePool:
+		return mode, nil
+	case "":
+		return ModeSingle, nil
+	default:
+		return "", fmt.Errorf("invalid PV check mode %q (expected %s, %s or %s)", mode, ModeSingle, ModeZone, ModeNodePool)
+	}
+}
+
+// nodeGroup is a set of nodes that get their own provisioning test.
+type nodeGroup struct {
+	Name      string
+	NodeCount int
+	// Nodes are the schedulable nodes the test Pod may run on: not cordoned, and without
+	// a NoSchedule or NoExecute taint the Pod does not tolerate.
+	Nodes []string
+	// Pinned is set when the test Pod must be restricted to Nodes.
+	Pinned bool
+}
+
+// groupNodes splits the nodes by zone or node pool; ModeSingle yields one unpinned group.
+func groupNodes(nodes []corev1.Node, mode string) []nodeGroup {
+	if mode == ModeSingle || mode == "" {
+		return []nodeGroup{{Name: "cluster", NodeCount: len(nodes)}}
+	}
+
+	byKey := map[string]*nodeGroup{}
+	for _, node := range nodes {
+		key := groupKey(node, mode)
+		g, ok := byKey[key]
+		if !ok {
+			g = &nodeGroup{Name: key, Pinned: true}
+			byKey[key] = g
+		}
+		g.NodeCount++
+		if schedulable(node) {
+			g.Nodes = append(g.Nodes, node.Name)
+		}
+	}
+
+	groups := make([]nodeGroup, 0, len(byKey))
+	for _, g := range byKey {
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// testPodTolerations are the tolerations of the test Pod.
+var testPodTolerations []corev1.Toleration
+
+// schedulable reports whether the test Pod may be scheduled on the node.
+func schedulable(node corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect != corev1.TaintEffectNoSchedule && taint.Effect != corev1.TaintEffectNoExecute {
+			continue
+		}
+		if !tolerated(taint) {
+			return false
+		}
+	}
+	return true
+}
+
+func tolerated(taint *corev1.Taint) bool {
+	for i := range testPodTolerations {
+		if testPodTolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+func groupKey(node corev1.Node, mode string) string {
+	switch mode {
+	case ModeZone:
+		if zone := node.Labels[zoneLabel]; zone != "" {
+			return "zone " + zone
+		}
+		if zone := node.Labels[legacyZoneLabel]; zone != "" {
+			return "zone " + zone
+		}
+		return "zone (none)"
+	default:
+		if pool := common.NodePool(node); pool != "" {
+			return "pool " + pool
+		}
+		return "pool (none)"
+	}
+}
+
+// nodeNameAffinity restricts a Pod to the given nodes by name, which works
+// regardless of how the nodes are labeled.
+func nodeNameAffinity(nodeNames []string) *corev1.Affinity {
+	return &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{
+						MatchFields: []corev1.NodeSelectorRequirement{
+							{
+								Key:      "metadata.name",
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   nodeNames,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,72 @@
+package pvcheck
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func zoneNode(name, zone string, taints ...corev1.Taint) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{zoneLabel: zone}},
+		Spec:       corev1.NodeSpec{Taints: taints},
+	}
+}
+
+func TestGroupNodesSkipsUnschedulableNodes(t *testing.T) {
+	controlPlane := corev1.Taint{Key: "node-role.kubernetes.io/control-plane", Effect: corev1.TaintEffectNoSchedule}
+	evicting := corev1.Taint{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoExecute}
+	preferred := corev1.Taint{Key: "spot", Effect: corev1.TaintEffectPreferNoSchedule}
+
+	cordoned := zoneNode("a-2", "a")
+	cordoned.Spec.Unschedulable = true
+	nodes := []corev1.Node{
+		zoneNode("a-1", "a"),
+		cordoned,
+		zoneNode("a-3", "a", preferred),
+		zoneNode("b-1", "b", controlPlane),
+		zoneNode("b-2", "b", evicting),
+	}
+
+	got := groupNodes(nodes, ModeZone)
+	want := []nodeGroup{
+		{Name: "zone a", NodeCount: 3, Nodes: []string{"a-1", "a-3"}, Pinned: true},
+		{Name: "zone b", NodeCount: 2, Pinned: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groupNodes() = %+v, want %+v", got, want)
+	}
+}
+
+func TestGroupNodesHonorsTolerations(t *testing.T) {
+	defer func(saved []corev1.Toleration) { testPodTolerations = saved }(testPodTolerations)
+	testPodTolerations = []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}}
+
+	nodes := []corev1.Node{
+		zoneNode("b-1", "b", corev1.Taint{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoExecute}),
+		zoneNode("b-2", "b", corev1.Taint{Key: "other", Effect: corev1.TaintEffectNoSchedule}),
+	}
+	got := groupNodes(nodes, ModeZone)
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Nodes, []string{"b-1"}) {
+		t.Errorf("groupNodes() = %+v, want only b-1 schedulable", got)
+	}
+}
+
+func TestAggregateResultsReportsTestedNodes(t *testing.T) {
+	targets := []storageClassTarget{{Name: "gp3", IsDefault: true}}
+	results := []GroupResult{
+		{StorageClass: "gp3", Group: "zone a", NodeCount: 3, Node: "a-1", Passed: true},
+		{StorageClass: "gp3", Group: "zone b", NodeCount: 2, Node: "b-1", Passed: true},
+	}
+
+	out := aggregateResults(results, targets, 5, Options{Mode: ModeZone})
+	if !strings.Contains(out.Reason, "ran on 2 of 5 nodes") {
+		t.Errorf("Reason = %q, want the 2 nodes the test Pods ran on", out.Reason)
+	}
+	if strings.Contains(out.Reason, "covered") {
+		t.Errorf("Reason = %q claims nodes covered by a single test Pod per group", out.Reason)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
@@ -19,37 +21,79 @@ const (
 	annDefaultStorageClass     = "storageclass.kubernetes.io/is-default-class"
 	annBetaDefaultStorageClass = "storageclass.beta.kubernetes.io/is-default-class"
 	noProvisioner              = "kubernetes.io/no-provisioner"
+
+	remediationInstallCSI = "Install a CSI driver with a dynamic StorageClass (e.g. EBS, PD or Azure Disk CSI)."
 )
 
-// PVCheckResult is a minimal struct containing pass/fail info.
+// PVCheckResult holds pass/fail counts together with the reason for the verdict.
 type PVCheckResult struct {
-	PassedCount   int
-	FailedCount   int
-	TotalNodes    int
-	ResultMessage string // Only "Passed", "Failed", or "Skipped"
+	// PassedCount and FailedCount are the nodes of the groups whose test passed or failed.
+	// Each test runs one Pod on one node of its group, so they are not nodes actually tested.
+	PassedCount int
+	FailedCount int
+	TotalNodes  int
+
+	Status      common.CheckStatus
+	Reason      string
+	Remediation string
+	Evidence    []common.ObjectRef
+
+	// Groups holds one entry per provisioning test, i.e. per StorageClass and node group.
+	Groups []GroupResult
+	// RecommendedStorageClass is set when the Kubescape chart should not rely on
+	// the cluster default StorageClass.
+	RecommendedStorageClass string
+}
+
+// GroupResult is the outcome of provisioning and mounting a volume for one group of nodes
+// with one StorageClass.
+type GroupResult struct {
+	StorageClass string
+	BindingMode  string
+	Group        string
+	NodeCount    int    // nodes in the group, of which the test Pod used one
+	Node         string // node the test Pod was scheduled on
+	Passed       bool
+	Reason       string
+	Remediation  string
+	Evidence     []common.ObjectRef
+	BindLatency  time.Duration // time until the PVC was Bound
+	Duration     time.Duration
+}
+
+// storageClassTarget is a StorageClass under test.
+type storageClassTarget struct {
+	Name        string
+	BindingMode string
+	IsDefault   bool
 }
 
 // RunPVProvisioningCheck first verifies that dynamic provisioning is likely available
-// and that there's a default StorageClass. Then it actually creates a 5Gi PVC + Pod
-// in a temporary namespace, waits for them to become ready, and verifies the PVC is bound.
+// and that there's a default StorageClass (or the one requested in opts). Then it actually
+// creates a 5Gi PVC + Pod in a temporary namespace, waits for them to become ready, and
+// verifies the PVC is bound. Outside ModeSingle this is done once per zone or node pool,
+// pinning each Pod to the group's nodes, and with opts.AllStorageClasses once per dynamic class.
 func RunPVProvisioningCheck(
 	ctx context.Context,
 	clientset *kubernetes.Clientset,
 	clusterData *common.ClusterData,
+	opts Options,
 ) *PVCheckResult {
 
 	// 1) Pre-checks for dynamic provisioning
-	passed, failReason := basicPreCheck(ctx, clientset, clusterData)
-	if !passed {
-		return failResult(len(clusterData.Nodes), failReason)
+	targets, failReason, remediation := basicPreCheck(ctx, clientset, clusterData, opts)
+	if len(targets) == 0 {
+		return failResult(len(clusterData.Nodes), failReason, remediation)
 	}
 
 	// 2) If all pre-checks pass, try a real creation of PVC + Pod
-	//    in an ephemeral namespace.
-	namespace := "armo-pv-check-ns"
-	if err := createNamespace(ctx, clientset, namespace); err != nil {
+	//    in an ephemeral namespace. Its name is generated, so that a run started while
+	//    the namespace of the previous one is still terminating does not collide with it.
+	namespace, err := createNamespace(ctx, clientset, "armo-pv-check-")
+	if err != nil {
 		return failResult(len(clusterData.Nodes),
-			fmt.Sprintf("Failed to create temporary namespace %q: %v", namespace, err))
+			fmt.Sprintf("Failed to create a temporary namespace: %v", err),
+			"Ensure the identity running the checker may create and delete namespaces.")
 	}
 
 	// Defer ensures cleanup even if we return early or panic
@@ -59,54 +103,229 @@ func RunPVProvisioningCheck(
 		}
 	}()
 
-	pvcName := "armo-pv-check-pvc"
-	podName := "armo-pv-check-pod"
+	// 3) Run one provisioning test per StorageClass and node group, concurrently
+	groups := groupNodes(clusterData.Nodes, opts.Mode)
+	results := make([]GroupResult, len(targets)*len(groups))
+	var wg sync.WaitGroup
+	for ti, target := range targets {
+		for gi, group := range groups {
+			i := ti*len(groups) + gi
+			pvcName, podName := "armo-pv-check-pvc", "armo-pv-check-pod"
+			if len(results) > 1 {
+				pvcName, podName = fmt.Sprintf("%s-%d", pvcName, i), fmt.Sprintf("%s-%d", podName, i)
+			}
 
-	// 2a) Create a 5Gi PVC, letting the cluster pick the default StorageClass.
-	if err := createTestPVC(ctx, clientset, namespace, pvcName, "5Gi"); err != nil {
-		return failResult(len(clusterData.Nodes),
-			fmt.Sprintf("Failed to create PVC: %v", err))
+			wg.Add(1)
+			go func(i int, target storageClassTarget, group nodeGroup) {
+				defer wg.Done()
+				results[i] = runProvisioningTest(ctx, clientset, namespace, pvcName, podName, target, group)
+			}(i, target, group)
+		}
 	}
+	wg.Wait()
 
-	// 2b) Create a Pod that references the PVC (no NodeName => let scheduler place it)
-	if err := createTestPod(ctx, clientset, namespace, podName, pvcName); err != nil {
-		return failResult(len(clusterData.Nodes),
-			fmt.Sprintf("Failed to create Pod: %v", err))
+	return aggregateResults(results, targets, len(clusterData.Nodes), opts)
+}
+
+// runProvisioningTest creates a 5Gi PVC with the target StorageClass and a Pod mounting it,
+// restricted to the group's nodes, and waits for both to become ready.
+func runProvisioningTest(
+	ctx context.Context,
+	clientset *kubernetes.Clientset,
+	namespace, pvcName, podName string,
+	target storageClassTarget,
+	group nodeGroup,
+) GroupResult {
+	start := time.Now()
+	res := GroupResult{
+		StorageClass: target.Name,
+		BindingMode:  target.BindingMode,
+		Group:        group.Name,
+		NodeCount:    group.NodeCount,
+	}
+	fail := func(reason, remediation string, evidence ...common.ObjectRef) GroupResult {
+		log.Printf("Dynamic PV check failed for StorageClass %s, %s: %s", target.Name, group.Name, reason)
+		res.Reason, res.Remediation, res.Evidence = reason, remediation, evidence
+		res.Duration = time.Since(start)
+		return res
+	}
+
+	if group.Pinned && len(group.Nodes) == 0 {
+		return fail("No schedulable node in this group: every node is cordoned or has a NoSchedule/NoExecute taint.",
+			"Uncordon or untaint a node of the group, or ignore the group if it is not meant to run Kubescape.")
+	}
+
+	// a) Create a 5Gi PVC with the target StorageClass.
+	if err := createTestPVC(ctx, clientset, namespace, pvcName, target.Name, "5Gi"); err != nil {
+		return fail(fmt.Sprintf("Failed to create PVC: %v", err),
+			"Ensure the identity running the checker may create PersistentVolumeClaims.")
 	}
 
-	// 2c) Wait for the PVC to be Bound (important if StorageClass uses WaitForFirstConsumer)
+	// b) Create a Pod that references the PVC; the scheduler places it within the group
+	if err := createTestPod(ctx, clientset, namespace, podName, pvcName, group.Nodes); err != nil {
+		return fail(fmt.Sprintf("Failed to create Pod: %v", err),
+			"Ensure the identity running the checker may create Pods and that no admission policy rejects them.")
+	}
+
+	// c) Wait for the PVC to be Bound (important if StorageClass uses WaitForFirstConsumer)
 	if err := waitForPVCBound(ctx, clientset, namespace, pvcName, 60*time.Second); err != nil {
-		return failResult(len(clusterData.Nodes),
-			fmt.Sprintf("PVC did not become Bound: %v", err))
+		return fail(fmt.Sprintf("PVC did not become Bound: %v", err),
+			fmt.Sprintf("Check that the CSI driver of StorageClass %q is installed and healthy, and that its cloud credentials allow creating volumes.", target.Name),
+			objectEvidence(ctx, clientset, namespace, "PersistentVolumeClaim", pvcName),
+			objectEvidence(ctx, clientset, namespace, "Pod", podName))
 	}
+	res.BindLatency = time.Since(start)
 
-	// 2d) Wait for the Pod to become Running or Succeeded
+	// d) Wait for the Pod to become Running or Succeeded
 	if err := waitForPodRunningOrSucceeded(ctx, clientset, namespace, podName, 60*time.Second); err != nil {
-		return failResult(len(clusterData.Nodes),
-			fmt.Sprintf("Pod did not become Running/Succeeded: %v", err))
+		return fail(fmt.Sprintf("Pod did not become Running/Succeeded: %v", err),
+			"Check that the provisioned volume can be attached to the node the Pod was scheduled on (zone, attach limits); with Immediate binding use a WaitForFirstConsumer StorageClass.",
+			objectEvidence(ctx, clientset, namespace, "Pod", podName))
 	}
 
-	// 3) If everything was successful => "Passed"
-	return &PVCheckResult{
-		PassedCount:   len(clusterData.Nodes),
-		FailedCount:   0,
-		TotalNodes:    len(clusterData.Nodes),
-		ResultMessage: "Passed",
+	if pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{}); err == nil {
+		res.Node = pod.Spec.NodeName
+	}
+	res.Passed = true
+	res.Reason = "A 5Gi PVC was provisioned, bound and mounted by a test Pod."
+	res.Duration = time.Since(start)
+	return res
+}
+
+// aggregateResults turns the per-test results into per-node counts, an overall verdict
+// and the StorageClass to recommend for the Kubescape chart.
+func aggregateResults(results []GroupResult, targets []storageClassTarget, totalNodes int, opts Options) *PVCheckResult {
+	out := &PVCheckResult{TotalNodes: totalNodes, Groups: results}
+
+	// A StorageClass works when its tests passed in every node group
+	classPassed := map[string]bool{}
+	for _, t := range targets {
+		classPassed[t.Name] = true
+	}
+	var firstFailed *GroupResult
+	var failedTests []string
+	for i := range results {
+		r := &results[i]
+		if r.Passed {
+			continue
+		}
+		classPassed[r.StorageClass] = false
+		failedTests = append(failedTests, testLabel(r, len(targets) > 1, opts.Mode != ModeSingle))
+		out.Evidence = append(out.Evidence, r.Evidence...)
+		if firstFailed == nil {
+			firstFailed = r
+		}
+	}
+
+	// Pick the class the Kubescape chart should use, and report node counts for it
+	chosen := chooseStorageClass(targets, classPassed)
+	counted := chosen
+	if counted == nil {
+		counted = &targets[0]
+	}
+	for _, r := range results {
+		if r.StorageClass != counted.Name {
+			continue
+		}
+		if r.Passed {
+			out.PassedCount += r.NodeCount
+		} else {
+			out.FailedCount += r.NodeCount
+		}
+	}
+	if chosen != nil && (!chosen.IsDefault || opts.StorageClass != "") {
+		out.RecommendedStorageClass = chosen.Name
+	}
+
+	switch {
+	case firstFailed == nil:
+		out.Status = common.StatusPass
+		out.Reason = fmt.Sprintf("A 5Gi PVC was provisioned, bound and mounted by a test Pod using StorageClass %q.", targets[0].Name)
+		if len(results) > 1 {
+			out.Reason = fmt.Sprintf("A 5Gi PVC was provisioned and mounted in all %d tests (%d StorageClasses, %d node groups); the test Pods ran on %d of %d nodes.",
+				len(results), len(targets), len(results)/len(targets), testedNodes(results), totalNodes)
+		}
+	case chosen != nil:
+		// Some classes fail, but at least one works everywhere
+		out.Status = common.StatusWarn
+		out.Reason = fmt.Sprintf("Provisioning failed in %d of %d tests (%s); StorageClass %q works on all tested nodes. First error: %s",
+			len(failedTests), len(results), strings.Join(failedTests, ", "), chosen.Name, firstFailed.Reason)
+		out.Remediation = fmt.Sprintf("Set storage.storageClass to %q in the Kubescape chart (see recommended-values.yaml), or fix the failing classes: %s",
+			chosen.Name, firstFailed.Remediation)
+	default:
+		out.Status = common.StatusFail
+		out.Reason = firstFailed.Reason
+		out.Remediation = firstFailed.Remediation
+		if len(results) > 1 {
+			out.Reason = fmt.Sprintf("Provisioning failed in %d of %d tests (%s), in node groups holding %d of %d nodes. First error: %s",
+				len(failedTests), len(results), strings.Join(failedTests, ", "), out.FailedCount, totalNodes, firstFailed.Reason)
+		}
+	}
+	return out
+}
+
+// testedNodes counts the distinct nodes the test Pods were scheduled on.
+func testedNodes(results []GroupResult) int {
+	nodes := map[string]struct{}{}
+	for _, r := range results {
+		if r.Node != "" {
+			nodes[r.Node] = struct{}{}
+		}
+	}
+	return len(nodes)
+}
+
+// chooseStorageClass prefers the default class, then WaitForFirstConsumer classes,
+// which provision volumes in the zone of the consuming Pod.
+func chooseStorageClass(targets []storageClassTarget, passed map[string]bool) *storageClassTarget {
+	var best *storageClassTarget
+	for i := range targets {
+		t := &targets[i]
+		if !passed[t.Name] {
+			continue
+		}
+		switch {
+		case t.IsDefault:
+			return t
+		case best == nil:
+			best = t
+		case best.BindingMode != string(storagev1.VolumeBindingWaitForFirstConsumer) &&
+			t.BindingMode == string(storagev1.VolumeBindingWaitForFirstConsumer):
+			best = t
+		}
+	}
+	return best
+}
+
+func testLabel(r *GroupResult, withClass, withGroup bool) string {
+	switch {
+	case withClass && withGroup:
+		return r.StorageClass + " / " + r.Group
+	case withClass:
+		return r.StorageClass
+	default:
+		return r.Group
 	}
 }
 
 // ---------------------------------------------------------------------
 // Basic Pre-Check to ensure dynamic provisioning likely works
 // ---------------------------------------------------------------------
+//
+// It returns the StorageClasses to test: the default one, the one named in
+// opts.StorageClass, or every dynamic class with opts.AllStorageClasses.
+// On failure the list is empty and a reason and remediation are returned.
 func basicPreCheck(
 	ctx context.Context,
 	clientset *kubernetes.Clientset,
 	clusterData *common.ClusterData,
-) (bool, string) {
+	opts Options,
+) ([]storageClassTarget, string, string) {
 
 	totalNodes := len(clusterData.Nodes)
 	if totalNodes == 0 {
-		return false, "No nodes found in cluster."
+		return nil, "No nodes found in cluster.",
+			"Add at least one schedulable worker node to the cluster."
 	}
 
 	// Ensure at least one node is schedulable
@@ -118,16 +337,19 @@ func basicPreCheck(
 		}
 	}
 	if !schedulableFound {
-		return false, "No schedulable node found (all unschedulable)."
+		return nil, "No schedulable node found (all unschedulable).",
+			"Uncordon a node (kubectl uncordon <node>) or add a schedulable node."
 	}
 
 	// Check if at least one StorageClass is present
 	scList, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
 	if err != nil {
-		return false, fmt.Sprintf("Failed to list StorageClasses: %v", err)
+		return nil, fmt.Sprintf("Failed to list StorageClasses: %v", err),
+			"Grant the checker permission to list storageclasses (storage.k8s.io)."
 	}
 	if len(scList.Items) == 0 {
-		return false, "No StorageClasses found; dynamic provisioning not available."
+		return nil, "No StorageClasses found; dynamic provisioning not available.",
+			remediationInstallCSI
 	}
 
 	// Identify dynamic StorageClasses
@@ -138,23 +360,54 @@ func basicPreCheck(
 		}
 	}
 	if len(dynamicSCs) == 0 {
-		return false, "All StorageClasses use 'no-provisioner'; no dynamic provisioning."
+		return nil, "All StorageClasses use 'no-provisioner'; no dynamic provisioning.",
+			remediationInstallCSI
 	}
 
-	// Require at least one default dynamic SC
-	hasDefault := false
-	for _, sc := range dynamicSCs {
-		if isStorageClassDefault(&sc) {
-			hasDefault = true
-			break
+	// Test every dynamic SC
+	if opts.AllStorageClasses {
+		targets := make([]storageClassTarget, 0, len(dynamicSCs))
+		for i := range dynamicSCs {
+			targets = append(targets, newTarget(&dynamicSCs[i]))
 		}
+		return targets, "", ""
 	}
-	if !hasDefault {
-		return false, "No default dynamic StorageClass found."
+
+	// Test the requested SC, which must exist and be dynamic
+	if opts.StorageClass != "" {
+		for i := range scList.Items {
+			sc := &scList.Items[i]
+			if sc.Name != opts.StorageClass {
+				continue
+			}
+			if sc.Provisioner == noProvisioner || sc.Provisioner == "" {
+				return nil, fmt.Sprintf("StorageClass %q uses 'no-provisioner'; no dynamic provisioning.", sc.Name),
+					"Pass a dynamic StorageClass to --storage-class, or use --all-storage-classes to find one that works."
+			}
+			return []storageClassTarget{newTarget(sc)}, "", ""
+		}
+		return nil, fmt.Sprintf("StorageClass %q not found.", opts.StorageClass),
+			"Pass an existing StorageClass to --storage-class (kubectl get storageclass)."
 	}
 
-	// If we got here, all “theoretical” checks pass
-	return true, ""
+	// Require at least one default dynamic SC
+	for i := range dynamicSCs {
+		if isStorageClassDefault(&dynamicSCs[i]) {
+			// If we got here, all “theoretical” checks pass
+			return []storageClassTarget{newTarget(&dynamicSCs[i])}, "", ""
+		}
+	}
+	return nil, "No default dynamic StorageClass found.",
+		fmt.Sprintf("Mark a dynamic StorageClass as default: kubectl patch storageclass <name> -p '{\"metadata\":{\"annotations\":{\"%s\":\"true\"}}}', "+
+			"or pass --storage-class / --all-storage-classes and set storage.storageClass in the Kubescape chart.", annDefaultStorageClass)
+}
+
+func newTarget(sc *storagev1.StorageClass) storageClassTarget {
+	mode := string(storagev1.VolumeBindingImmediate)
+	if sc.VolumeBindingMode != nil {
+		mode = string(*sc.VolumeBindingMode)
+	}
+	return storageClassTarget{Name: sc.Name, BindingMode: mode, IsDefault: isStorageClassDefault(sc)}
 }
 
 func isStorageClassDefault(sc *storagev1.StorageClass) bool {
@@ -173,18 +426,22 @@ func isStorageClassDefault(sc *storagev1.StorageClass) bool {
 // ---------------------------------------------------------------------
 // Creating resources
 // ---------------------------------------------------------------------
-func createNamespace(ctx context.Context, clientset *kubernetes.Clientset, name string) error {
+// createNamespace creates a namespace named generateName plus a random suffix and returns its name.
+func createNamespace(ctx context.Context, clientset *kubernetes.Clientset, generateName string) (string, error) {
 	nsObj := &corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
+			GenerateName: generateName,
+			Labels:       map[string]string{"app": "armo-pv-check"},
 		},
 	}
-	_, err := clientset.CoreV1().Namespaces().Create(ctx, nsObj, metav1.CreateOptions{})
-	return err
+	created, err := clientset.CoreV1().Namespaces().Create(ctx, nsObj, metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+	return created.Name, nil
 }
 
-func createTestPVC(ctx context.Context, clientset *kubernetes.Clientset, namespace, pvcName, size string) error {
-	// Using no 'storageClassName' => let the cluster pick the default SC
+func createTestPVC(ctx context.Context, clientset *kubernetes.Clientset, namespace, pvcName, storageClass, size string) error {
 	qty, err := resource.ParseQuantity(size)
 	if err != nil {
 		return fmt.Errorf("invalid size quantity %q: %w", size, err)
@@ -195,6 +452,7 @@ func createTestPVC(ctx context.Context, clientset *kubernetes.Clientset, namespa
 			Name: pvcName,
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: &storageClass,
 			AccessModes: []corev1.PersistentVolumeAccessMode{
 				corev1.ReadWriteOnce,
 			},
@@ -209,13 +467,14 @@ func createTestPVC(ctx context.Context, clientset *kubernetes.Clientset, namespa
 	return createErr
 }
 
-func createTestPod(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName, pvcName string) error {
+func createTestPod(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName, pvcName string, nodeNames []string) error {
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: podName,
 		},
 		Spec: corev1.PodSpec{
 			RestartPolicy: corev1.RestartPolicyNever,
+			Tolerations:   testPodTolerations,
 			Containers: []corev1.Container{
 				{
 					Name:  "pv-check-container",
@@ -240,6 +499,9 @@ func createTestPod(ctx context.Context, clientset *kubernetes.Clientset, namespa
 			},
 		},
 	}
+	if len(nodeNames) > 0 {
+		pod.Spec.Affinity = nodeNameAffinity(nodeNames)
+	}
 	_, err := clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
 	return err
 }
@@ -285,13 +547,41 @@ func deleteNamespace(ctx context.Context, clientset *kubernetes.Clientset, ns st
 	return clientset.CoreV1().Namespaces().Delete(ctx, ns, metav1.DeleteOptions{})
 }
 
-func failResult(totalNodes int, reason string) *PVCheckResult {
-	// We only return "Passed" or "Failed", but let's log the reason.
+func failResult(totalNodes int, reason, remediation string, evidence ...common.ObjectRef) *PVCheckResult {
 	log.Printf("Dynamic PV check failed: %s", reason)
 	return &PVCheckResult{
-		PassedCount:   0,
-		FailedCount:   totalNodes,
-		TotalNodes:    totalNodes,
-		ResultMessage: "Failed",
+		PassedCount: 0,
+		FailedCount: totalNodes,
+		TotalNodes:  totalNodes,
+		Status:      common.StatusFail,
+		Reason:      reason,
+		Remediation: remediation,
+		Evidence:    evidence,
+	}
+}
+
+// objectEvidence references a test object and attaches its latest event message,
+// which usually holds the provisioner or scheduler error.
+func objectEvidence(ctx context.Context, clientset *kubernetes.Clientset, ns, kind, name string) common.ObjectRef {
+	ref := common.ObjectRef{Kind: kind, Namespace: ns, Name: name}
+
+	events, err := clientset.CoreV1().Events(ns).List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.kind=%s,involvedObject.name=%s", kind, name),
+	})
+	if err != nil {
+		ref.Detail = fmt.Sprintf("could not list events: %v", err)
+		return ref
+	}
+
+	var latest *corev1.Event
+	for i := range events.Items {
+		ev := &events.Items[i]
+		if latest == nil || ev.LastTimestamp.After(latest.LastTimestamp.Time) {
+			latest = ev
+		}
+	}
+	if latest != nil {
+		ref.Detail = fmt.Sprintf("%s: %s", latest.Reason, latest.Message)
 	}
+	return ref
 }
@@ -0,0 +1,187 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/checks/ebpf"
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/checks/network"
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/checks/nodecompat"
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/checks/permissions"
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/checks/pvcheck"
+	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
+	"k8s.io/client-go/kubernetes"
+)
+
+// RunOptions controls which registered checks are executed.
+type RunOptions struct {
+	// ActiveChecks enables checks that deploy resources on the cluster.
+	ActiveChecks bool
+	// Checks limits the run to checks matching any of these names or tags.
+	// An empty list selects every check.
+	Checks []string
+	// SkipChecks excludes checks matching any of these names or tags.
+	SkipChecks []string
+}
+
+// Registry holds the prerequisite checks in the order they are reported.
+type Registry struct {
+	checkers []common.Checker
+	names    map[string]struct{}
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+// Config carries the per-check settings coming from the command line.
+type Config struct {
+	Network    network.Options
+	EBPF       ebpf.Options
+	NodeCompat nodecompat.Options
+	Helm       permissions.Options
+	PV         pvcheck.Options
+}
+
+// DefaultRegistry returns a registry with every built-in check.
+// New checks only need to be added here to appear in all outputs.
+func DefaultRegistry(cfg Config) *Registry {
+	r := NewRegistry()
+	r.MustRegister(nodecompat.NewChecker(cfg.NodeCompat))
+	r.MustRegister(permissions.NewChecker(cfg.Helm))
+	r.MustRegister(pvcheck.NewChecker(cfg.PV))
+	r.MustRegister(network.NewChecker(cfg.Network))
+	r.MustRegister(ebpf.NewChecker(cfg.EBPF))
+	return r
+}
+
+// Register adds a checker; names must be unique.
+func (r *Registry) Register(c common.Checker) error {
+	if _, exists := r.names[c.Name()]; exists {
+		return fmt.Errorf("check %q is already registered", c.Name())
+	}
+	r.names[c.Name()] = struct{}{}
+	r.checkers = append(r.checkers, c)
+	return nil
+}
+
+// MustRegister is like Register but panics on a duplicate name.
+func (r *Registry) MustRegister(c common.Checker) {
+	if err := r.Register(c); err != nil {
+		panic(err)
+	}
+}
+
+// Checkers returns the registered checks in registration order.
+func (r *Registry) Checkers() []common.Checker {
+	return r.checkers
+}
+
+// Validate returns an error for selectors that match no registered check name or tag.
+func (r *Registry) Validate(selectors []string) error {
+	var unknown []string
+	for _, sel := range selectors {
+		found := false
+		for _, c := range r.checkers {
+			if matches(c, sel) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unknown = append(unknown, sel)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown check name or tag: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// Run executes every registered check and returns their results in registration order.
+// Checks deselected by opts.Checks/opts.SkipChecks are reported as skipped by the user,
+// and active checks are reported as skipped unless opts.ActiveChecks is set.
+func (r *Registry) Run(
+	ctx context.Context,
+	clientset *kubernetes.Clientset,
+	clusterData *common.ClusterData,
+	opts RunOptions,
+) []common.CheckResult {
+	results := make([]common.CheckResult, 0, len(r.checkers))
+	for _, c := range r.checkers {
+		var result *common.CheckResult
+		if !selected(c, opts) {
+			result = &common.CheckResult{
+				Status: common.StatusSkip,
+				Reason: "by user",
+			}
+		} else if c.Type() == common.CheckTypeActive && !opts.ActiveChecks {
+			result = &common.CheckResult{
+				Status: common.StatusSkip,
+				Reason: "requires --active-checks",
+			}
+		} else {
+			result = c.Run(ctx, clientset, clusterData)
+		}
+		if result == nil {
+			result = &common.CheckResult{
+				Status: common.StatusError,
+				Reason: "check returned no result",
+			}
+		}
+		if result.Severity == "" {
+			result.Severity = defaultSeverity(result.Status)
+		}
+
+		result.Name = c.Name()
+		result.Description = c.Description()
+		result.Type = c.Type()
+		results = append(results, *result)
+	}
+	return results
+}
+
+// selected applies the --checks and --skip-checks lists to a check.
+func selected(c common.Checker, opts RunOptions) bool {
+	for _, sel := range opts.SkipChecks {
+		if matches(c, sel) {
+			return false
+		}
+	}
+	if len(opts.Checks) == 0 {
+		return true
+	}
+	for _, sel := range opts.Checks {
+		if matches(c, sel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether a selector names the check, its type ("active"/"passive") or one of its tags.
+func matches(c common.Checker, selector string) bool {
+	selector = strings.ToLower(strings.TrimSpace(selector))
+	if selector == strings.ToLower(c.Name()) || selector == string(c.Type()) {
+		return true
+	}
+	for _, tag := range c.Tags() {
+		if selector == strings.ToLower(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultSeverity is used when a check does not set a severity of its own.
+func defaultSeverity(status common.CheckStatus) common.Severity {
+	switch status {
+	case common.StatusFail, common.StatusError:
+		return common.SeverityHigh
+	case common.StatusWarn:
+		return common.SeverityMedium
+	default:
+		return common.SeverityInfo
+	}
+}
@@ -3,6 +3,8 @@ package sizing
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/armosec/armo-platform-tools/poc-prerequisite/pkg/common"
 	"k8s.io/client-go/kubernetes"
@@ -42,12 +44,42 @@ func RunSizingChecker(ctx context.Context, clientset *kubernetes.Clientset, data
 		DefaultResourceAllocations: defaultResourceAllocations,
 		FinalResourceAllocations:   finalResourceAllocations,
 		HasAnyAdjustments:          computeHasAnyAdjustments(defaultResourceAllocations, finalResourceAllocations),
+		AccuracyNotes:              accuracyNotes(data),
 	}
 }
 
-// For example, countAllResources might sum up the lengths of pods, services,
-// deployments, etc. stored in clusterData.
+// accuracyNotes describes which recommendations are based on incomplete data.
+func accuracyNotes(cd *common.ClusterData) []string {
+	var notes, workloads []string
+	for _, kind := range cd.MissingKinds() {
+		switch kind {
+		case "nodes":
+			notes = append(notes, "Nodes could not be listed: node-agent CPU/memory and kubevuln memory fall back to the defaults and may be too low.")
+		case "version":
+			notes = append(notes, "The Kubernetes version is unknown; sizing is not affected.")
+		default:
+			workloads = append(workloads, kind)
+		}
+	}
+	if len(workloads) > 0 {
+		notes = append(notes, fmt.Sprintf("%s could not be listed: the total resource count is underestimated, so storage memory may be too low.",
+			strings.Join(workloads, ", ")))
+	}
+	return notes
+}
+
+// countAllResources sums up the workload objects (everything but nodes) in clusterData,
+// using the collected counts when the objects themselves were not kept.
 func countAllResources(cd *common.ClusterData) int {
+	if len(cd.ResourceCounts) > 0 {
+		total := 0
+		for kind, count := range cd.ResourceCounts {
+			if kind != "nodes" {
+				total += count
+			}
+		}
+		return total
+	}
 	return len(cd.Pods) + len(cd.Services) +
 		len(cd.Deployments) + len(cd.ReplicaSets) +
 		len(cd.StatefulSets) + len(cd.DaemonSets) +
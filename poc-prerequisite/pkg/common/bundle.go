@@ -0,0 +1,111 @@
+package common
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// ManifestFile lists every file of a run with its size and checksum, as JSON.
+	ManifestFile = "manifest.json"
+	// ChecksumsFile lists the same checksums in the format of `sha256sum -c`.
+	ChecksumsFile = "SHA256SUMS"
+)
+
+// BundleInfo describes the run a bundle is built for.
+type BundleInfo struct {
+	// RunName is the "<timestamp>-<cluster>" name of the bundle and of its top directory.
+	RunName     string
+	Cluster     string
+	GeneratedAt time.Time
+}
+
+// Manifest is the content of manifest.json.
+type Manifest struct {
+	Cluster     string          `json:"cluster"`
+	GeneratedAt string          `json:"generatedAt"`
+	Files       []ManifestEntry `json:"files"`
+}
+
+type ManifestEntry struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// BuildManifest lists the artifacts with their size and SHA-256, for tools that read the
+// run as JSON. BuildChecksums writes the same checksums for `sha256sum -c`.
+func BuildManifest(info BundleInfo, artifacts []Artifact) (Artifact, error) {
+	manifest := Manifest{
+		Cluster:     info.Cluster,
+		GeneratedAt: info.GeneratedAt.UTC().Format(time.RFC3339),
+		Files:       []ManifestEntry{},
+	}
+	for _, a := range artifacts {
+		sum := sha256.Sum256([]byte(a.Content))
+		manifest.Files = append(manifest.Files, ManifestEntry{
+			Name:   a.FileName,
+			Size:   len(a.Content),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return Artifact{}, err
+	}
+	return Artifact{ArtifactManifest, ManifestFile, "File checksums", string(b) + "\n"}, nil
+}
+
+// BuildChecksums lists the SHA-256 of every artifact as "<hex>  <file>" lines, so that the files
+// can be verified with `sha256sum -c SHA256SUMS` after they were passed around.
+func BuildChecksums(artifacts []Artifact) Artifact {
+	var sb strings.Builder
+	for _, a := range artifacts {
+		sum := sha256.Sum256([]byte(a.Content))
+		fmt.Fprintf(&sb, "%s  %s\n", hex.EncodeToString(sum[:]), a.FileName)
+	}
+	return Artifact{ArtifactChecksums, ChecksumsFile, "File checksums for sha256sum -c", sb.String()}
+}
+
+// WriteBundle writes the artifacts into dir/kubescape-prerequisites-<runName>.tar.gz, under a
+// <runName>/ directory so that bundles of several runs extract side by side. It returns the path.
+func WriteBundle(dir, runName string, artifacts []Artifact) (string, error) {
+	path := filepath.Join(dir, "kubescape-prerequisites-"+runName+".tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, a := range artifacts {
+		header := &tar.Header{
+			Name:    runName + "/" + a.FileName,
+			Mode:    0644,
+			Size:    int64(len(a.Content)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return "", err
+		}
+		if _, err := tw.Write([]byte(a.Content)); err != nil {
+			return "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	return path, f.Close()
+}
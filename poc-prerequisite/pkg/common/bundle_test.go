@@ -0,0 +1,32 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestBuildChecksums(t *testing.T) {
+	artifacts := []Artifact{
+		{FileName: ValuesFile, Content: "storage:\n  storageClass: gp3\n"},
+		{FileName: ManifestFile, Content: "{}\n"},
+	}
+
+	lines := strings.Split(strings.TrimSuffix(BuildChecksums(artifacts).Content, "\n"), "\n")
+	if len(lines) != len(artifacts) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(artifacts))
+	}
+	for i, line := range lines {
+		// sha256sum -c expects "<64 hex digits><two spaces><file name>"
+		sum, name, ok := strings.Cut(line, "  ")
+		if !ok || name != artifacts[i].FileName {
+			t.Errorf("line %q does not name %s", line, artifacts[i].FileName)
+			continue
+		}
+		want := sha256.Sum256([]byte(artifacts[i].Content))
+		if sum != hex.EncodeToString(want[:]) {
+			t.Errorf("%s: checksum %s, want %x", name, sum, want)
+		}
+	}
+}
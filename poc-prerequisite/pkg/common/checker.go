@@ -0,0 +1,31 @@
+package common
+
+import (
+	"context"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// CheckType tells whether a check only reads cluster state (passive)
+// or deploys resources on the cluster to verify a prerequisite (active).
+type CheckType string
+
+const (
+	CheckTypePassive CheckType = "passive"
+	CheckTypeActive  CheckType = "active"
+)
+
+// Checker is implemented by every prerequisite check so the checker binary
+// can run, select and report on checks without knowing about them.
+type Checker interface {
+	// Name is a short, unique identifier such as "pv-provisioning".
+	Name() string
+	// Description is a human readable summary shown in the report.
+	Description() string
+	// Type reports whether the check is passive or active.
+	Type() CheckType
+	// Tags groups checks for selection on the command line, e.g. "storage" or "network".
+	Tags() []string
+	// Run executes the check against the cluster and returns its result.
+	Run(ctx context.Context, clientset *kubernetes.Clientset, clusterData *ClusterData) *CheckResult
+}
@@ -3,33 +3,106 @@ package common
 
 import (
 	"log"
-	"os"
-	"path/filepath"
+	"sort"
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
-func BuildKubeClient() (*kubernetes.Clientset, bool) {
-	inCluster := true
-	config, err := rest.InClusterConfig()
+// ClientOptions select the kubeconfig, context and impersonated identity of the kube client.
+type ClientOptions struct {
+	// Kubeconfig is an explicit kubeconfig path; empty follows $KUBECONFIG and then ~/.kube/config.
+	Kubeconfig string
+	// Context overrides the current-context of the kubeconfig.
+	Context string
+	// As and AsGroups impersonate a user and its groups.
+	As       string
+	AsGroups []string
+}
+
+// BuildKubeClient returns a clientset and its REST config (used to build other clients,
+// e.g. the metadata client), and whether we run inside the cluster.
+// The in-cluster config is only used when no kubeconfig or context was requested.
+func BuildKubeClient(opts ClientOptions) (*kubernetes.Clientset, *rest.Config, bool) {
+	config, inCluster, err := loadRESTConfig(opts)
 	if err != nil {
-		// Fallback to local kubeconfig => we're not in-cluster
-		inCluster = false
-		kubeconfig := filepath.Join(os.Getenv("HOME"), ".kube", "config")
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			log.Printf("Could not load in-cluster or local kubeconfig: %v", err)
-			return nil, inCluster
-		}
+		log.Printf("Could not load kube config: %v", err)
+		return nil, nil, inCluster
 	}
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		log.Printf("Failed to create Kubernetes clientset: %v", err)
-		return nil, inCluster
+		return nil, nil, inCluster
+	}
+
+	return clientset, config, inCluster
+}
+
+// ListContexts returns the sorted context names of the kubeconfig selected by opts.
+func ListContexts(opts ClientOptions) ([]string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = opts.Kubeconfig
+	raw, err := rules.Load()
+	if err != nil {
+		return nil, err
+	}
+	contexts := make([]string, 0, len(raw.Contexts))
+	for name := range raw.Contexts {
+		contexts = append(contexts, name)
+	}
+	sort.Strings(contexts)
+	return contexts, nil
+}
+
+// ClusterName names the cluster selected by opts after its kubeconfig context, "in-cluster" in a pod.
+func ClusterName(opts ClientOptions, inCluster bool) string {
+	if inCluster {
+		return "in-cluster"
+	}
+	if opts.Context != "" {
+		return opts.Context
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = opts.Kubeconfig
+	if raw, err := rules.Load(); err == nil && raw.CurrentContext != "" {
+		return raw.CurrentContext
+	}
+	return "cluster"
+}
+
+func loadRESTConfig(opts ClientOptions) (*rest.Config, bool, error) {
+	if opts.Kubeconfig == "" && opts.Context == "" {
+		if config, err := rest.InClusterConfig(); err == nil {
+			config.Impersonate = rest.ImpersonationConfig{UserName: opts.As, Groups: opts.AsGroups}
+			return config, true, nil
+		}
 	}
 
-	return clientset, inCluster
+	// Standard loading rules: --kubeconfig, else $KUBECONFIG (merged), else ~/.kube/config
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = opts.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: opts.Context,
+		AuthInfo: clientcmdapi.AuthInfo{
+			Impersonate:       opts.As,
+			ImpersonateGroups: opts.AsGroups,
+		},
+	}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, false, err
+	}
+	if raw, err := clientConfig.RawConfig(); err == nil {
+		current := raw.CurrentContext
+		if opts.Context != "" {
+			current = opts.Context
+		}
+		log.Printf("Using kubeconfig context %q", current)
+	}
+	return config, false, nil
 }
@@ -2,152 +2,351 @@ package common
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"strings"
+	"sync"
+	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 )
 
-func CollectClusterData(ctx context.Context, clientset *kubernetes.Clientset) (*ClusterData, error) {
-	cd := &ClusterData{}
+// Defaults for CollectOptions.
+const (
+	DefaultPageSize    = 500
+	DefaultWorkers     = 4
+	DefaultCallTimeout = 60 * time.Second
 
-	// 1) Get the Kubernetes version
-	kubeVersion, err := clientset.Discovery().ServerVersion()
-	if err != nil {
-		log.Fatalf("Cannot access cluster: %v", err)
-	}
-	cd.ClusterDetails.Version = kubeVersion.String()
+	// maxListRestarts bounds how often a paged list restarts after its Continue token expired.
+	maxListRestarts = 3
+)
 
-	// 2) List nodes
-	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Printf("Failed to list nodes: %v", err)
-		return cd, err
+// CollectOptions tunes how cluster data is listed, for large clusters.
+type CollectOptions struct {
+	// PageSize is the Limit of every List call; results are followed with Continue.
+	PageSize int64
+	// Workers bounds how many resource kinds are listed concurrently.
+	Workers int
+	// CallTimeout bounds every single API call (one List page).
+	CallTimeout time.Duration
+	// MetadataOnly lists workload kinds through the metadata client and only counts them;
+	// full objects are kept for nodes only. This keeps memory flat on large clusters.
+	MetadataOnly bool
+}
+
+func (o *CollectOptions) setDefaults() {
+	if o.PageSize <= 0 {
+		o.PageSize = DefaultPageSize
+	}
+	if o.Workers <= 0 {
+		o.Workers = DefaultWorkers
 	}
-	cd.Nodes = nodes.Items
+	if o.CallTimeout <= 0 {
+		o.CallTimeout = DefaultCallTimeout
+	}
+}
 
-	gatherNodeInfoSummaries(&cd.NodeInfoSummaries, nodes.Items)
+// collectTask lists one resource kind into its ClusterData field.
+type collectTask struct {
+	kind string
+	run  func(ctx context.Context) (count, pages int, err error)
+}
 
-	// 3) Detect Cloud Provider & Distribution from nodes
-	cd.ClusterDetails.CloudProvider = detectCloudProvider(nodes.Items)
-	cd.ClusterDetails.K8sDistribution = detectK8sDistribution(nodes.Items)
+// workloadResources are listed through the metadata client in MetadataOnly mode.
+var workloadResources = map[string]schema.GroupVersionResource{
+	"pods":         corev1.SchemeGroupVersion.WithResource("pods"),
+	"services":     corev1.SchemeGroupVersion.WithResource("services"),
+	"deployments":  appsv1.SchemeGroupVersion.WithResource("deployments"),
+	"replicasets":  appsv1.SchemeGroupVersion.WithResource("replicasets"),
+	"statefulsets": appsv1.SchemeGroupVersion.WithResource("statefulsets"),
+	"daemonsets":   appsv1.SchemeGroupVersion.WithResource("daemonsets"),
+	"jobs":         batchv1.SchemeGroupVersion.WithResource("jobs"),
+	"cronjobs":     batchv1.SchemeGroupVersion.WithResource("cronjobs"),
+}
 
-	// 4) Calculate total node count & total vCPUs
-	cd.ClusterDetails.TotalNodeCount = len(nodes.Items)
-	var totalMilliCPU int64
-	for _, node := range nodes.Items {
-		totalMilliCPU += node.Status.Capacity.Cpu().MilliValue()
+// CollectClusterData lists the cluster resources used by sizing and the checks.
+// metadataClient is only required with opts.MetadataOnly.
+func CollectClusterData(
+	ctx context.Context,
+	clientset *kubernetes.Clientset,
+	metadataClient metadata.Interface,
+	opts CollectOptions,
+) (*ClusterData, error) {
+	opts.setDefaults()
+	if opts.MetadataOnly && metadataClient == nil {
+		return nil, fmt.Errorf("metadata-only collection requires a metadata client")
 	}
-	cd.ClusterDetails.TotalVCPUCount = int(totalMilliCPU / 1000)
+	cd := &ClusterData{MetadataOnly: opts.MetadataOnly}
+	start := time.Now()
 
-	// 5) List other resources
-	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Printf("Failed to list pods: %v", err)
-		return cd, err
+	// 1) Get the Kubernetes version
+	cd.CollectionErrors = map[string]string{}
+	if kubeVersion, err := ServerVersion(ctx, clientset, opts.CallTimeout); err != nil {
+		log.Printf("Failed to get the Kubernetes version: %v", err)
+		cd.CollectionErrors["version"] = err.Error()
+		cd.ClusterDetails.Version = "unknown"
+	} else {
+		cd.ClusterDetails.Version = kubeVersion.String()
 	}
-	cd.Pods = pods.Items
 
-	services, err := clientset.CoreV1().Services("").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Printf("Failed to list services: %v", err)
-		return cd, err
+	// 2) List nodes and the other resources, a bounded number of kinds at a time.
+	//    Every task writes to its own ClusterData field, so a kind that fails to list
+	//    (e.g. forbidden by RBAC or not served by an old cluster) leaves the others intact.
+	core, apps, batch := clientset.CoreV1(), clientset.AppsV1(), clientset.BatchV1()
+	tasks := []collectTask{
+		{"nodes", func(ctx context.Context) (int, int, error) {
+			return listAll(ctx, opts, &cd.Nodes, func(ctx context.Context, lo metav1.ListOptions) ([]corev1.Node, string, error) {
+				l, err := core.Nodes().List(ctx, lo)
+				if err != nil {
+					return nil, "", err
+				}
+				return l.Items, l.Continue, nil
+			})
+		}},
+		{"pods", func(ctx context.Context) (int, int, error) {
+			return listAll(ctx, opts, &cd.Pods, func(ctx context.Context, lo metav1.ListOptions) ([]corev1.Pod, string, error) {
+				l, err := core.Pods("").List(ctx, lo)
+				if err != nil {
+					return nil, "", err
+				}
+				return l.Items, l.Continue, nil
+			})
+		}},
+		{"services", func(ctx context.Context) (int, int, error) {
+			return listAll(ctx, opts, &cd.Services, func(ctx context.Context, lo metav1.ListOptions) ([]corev1.Service, string, error) {
+				l, err := core.Services("").List(ctx, lo)
+				if err != nil {
+					return nil, "", err
+				}
+				return l.Items, l.Continue, nil
+			})
+		}},
+		{"deployments", func(ctx context.Context) (int, int, error) {
+			return listAll(ctx, opts, &cd.Deployments, func(ctx context.Context, lo metav1.ListOptions) ([]appsv1.Deployment, string, error) {
+				l, err := apps.Deployments("").List(ctx, lo)
+				if err != nil {
+					return nil, "", err
+				}
+				return l.Items, l.Continue, nil
+			})
+		}},
+		{"replicasets", func(ctx context.Context) (int, int, error) {
+			return listAll(ctx, opts, &cd.ReplicaSets, func(ctx context.Context, lo metav1.ListOptions) ([]appsv1.ReplicaSet, string, error) {
+				l, err := apps.ReplicaSets("").List(ctx, lo)
+				if err != nil {
+					return nil, "", err
+				}
+				return l.Items, l.Continue, nil
+			})
+		}},
+		{"statefulsets", func(ctx context.Context) (int, int, error) {
+			return listAll(ctx, opts, &cd.StatefulSets, func(ctx context.Context, lo metav1.ListOptions) ([]appsv1.StatefulSet, string, error) {
+				l, err := apps.StatefulSets("").List(ctx, lo)
+				if err != nil {
+					return nil, "", err
+				}
+				return l.Items, l.Continue, nil
+			})
+		}},
+		{"daemonsets", func(ctx context.Context) (int, int, error) {
+			return listAll(ctx, opts, &cd.DaemonSets, func(ctx context.Context, lo metav1.ListOptions) ([]appsv1.DaemonSet, string, error) {
+				l, err := apps.DaemonSets("").List(ctx, lo)
+				if err != nil {
+					return nil, "", err
+				}
+				return l.Items, l.Continue, nil
+			})
+		}},
+		{"jobs", func(ctx context.Context) (int, int, error) {
+			return listAll(ctx, opts, &cd.Jobs, func(ctx context.Context, lo metav1.ListOptions) ([]batchv1.Job, string, error) {
+				l, err := batch.Jobs("").List(ctx, lo)
+				if err != nil {
+					return nil, "", err
+				}
+				return l.Items, l.Continue, nil
+			})
+		}},
+		{"cronjobs", func(ctx context.Context) (int, int, error) {
+			return listAll(ctx, opts, &cd.CronJobs, func(ctx context.Context, lo metav1.ListOptions) ([]batchv1.CronJob, string, error) {
+				l, err := batch.CronJobs("").List(ctx, lo)
+				if err != nil {
+					return nil, "", err
+				}
+				return l.Items, l.Continue, nil
+			})
+		}},
 	}
-	cd.Services = services.Items
 
-	deployments, err := clientset.AppsV1().Deployments("").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Printf("Failed to list deployments: %v", err)
-		return cd, err
+	if opts.MetadataOnly {
+		for i := range tasks {
+			if gvr, ok := workloadResources[tasks[i].kind]; ok {
+				tasks[i].run = metadataCountTask(metadataClient, gvr, opts)
+			}
+		}
 	}
-	cd.Deployments = deployments.Items
 
-	replicasets, err := clientset.AppsV1().ReplicaSets("").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Printf("Failed to list replicasets: %v", err)
-		return cd, err
-	}
-	cd.ReplicaSets = replicasets.Items
+	cd.CollectionStats = runCollectTasks(ctx, tasks, opts.Workers)
+	cd.CollectionDuration = time.Since(start)
 
-	statefulsets, err := clientset.AppsV1().StatefulSets("").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Printf("Failed to list statefulsets: %v", err)
-		return cd, err
+	cd.ResourceCounts = make(map[string]int, len(cd.CollectionStats))
+	for _, st := range cd.CollectionStats {
+		cd.ResourceCounts[st.Kind] = st.Count
 	}
-	cd.StatefulSets = statefulsets.Items
 
-	daemonsets, err := clientset.AppsV1().DaemonSets("").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Printf("Failed to list daemonsets: %v", err)
-		return cd, err
+	for _, st := range cd.CollectionStats {
+		if st.Error != "" {
+			log.Printf("Failed to list %s: %s", st.Kind, st.Error)
+			cd.CollectionErrors[st.Kind] = st.Error
+		}
 	}
-	cd.DaemonSets = daemonsets.Items
 
-	jobs, err := clientset.BatchV1().Jobs("").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Printf("Failed to list jobs: %v", err)
-		return cd, err
-	}
-	cd.Jobs = jobs.Items
+	// 3) Derive the node summaries and cluster details
+	summarizeNodes(cd)
 
-	cronjobs, err := clientset.BatchV1().CronJobs("").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Printf("Failed to list cronjobs: %v", err)
-		return cd, err
+	if len(cd.CollectionErrors) > 0 {
+		return cd, fmt.Errorf("incomplete cluster data, missing: %s", strings.Join(cd.MissingKinds(), ", "))
 	}
-	cd.CronJobs = cronjobs.Items
-
-	stripManagedFields(cd)
-
 	return cd, nil
 }
 
-func stripManagedFields(cd *ClusterData) {
-	// Remove from Nodes
-	for i := range cd.Nodes {
-		cd.Nodes[i].ManagedFields = nil
-	}
+// summarizeNodes derives the node info summaries, cloud provider, distribution,
+// node count and vCPU count from cd.Nodes.
+func summarizeNodes(cd *ClusterData) {
+	gatherNodeInfoSummaries(&cd.NodeInfoSummaries, cd.Nodes)
 
-	// Remove from Pods
-	for i := range cd.Pods {
-		cd.Pods[i].ManagedFields = nil
-	}
+	cd.ClusterDetails.CloudProvider = detectCloudProvider(cd.Nodes)
+	cd.ClusterDetails.K8sDistribution = detectK8sDistribution(cd.Nodes)
 
-	// Remove from Services
-	for i := range cd.Services {
-		cd.Services[i].ManagedFields = nil
+	cd.ClusterDetails.TotalNodeCount = len(cd.Nodes)
+	var totalMilliCPU int64
+	for _, node := range cd.Nodes {
+		totalMilliCPU += node.Status.Capacity.Cpu().MilliValue()
 	}
+	cd.ClusterDetails.TotalVCPUCount = int(totalMilliCPU / 1000)
+}
 
-	// Remove from Deployments
-	for i := range cd.Deployments {
-		cd.Deployments[i].ManagedFields = nil
-	}
+// ServerVersion is Discovery().ServerVersion() bounded by ctx and timeout,
+// so an unreachable API server cannot hang the collection.
+func ServerVersion(ctx context.Context, clientset *kubernetes.Clientset, timeout time.Duration) (*version.Info, error) {
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	// Remove from ReplicaSets
-	for i := range cd.ReplicaSets {
-		cd.ReplicaSets[i].ManagedFields = nil
+	body, err := clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(callCtx).Raw()
+	if err != nil {
+		return nil, err
 	}
+	var info version.Info
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("unable to parse the server version: %w", err)
+	}
+	return &info, nil
+}
 
-	// Remove from StatefulSets
-	for i := range cd.StatefulSets {
-		cd.StatefulSets[i].ManagedFields = nil
+// runCollectTasks runs the tasks on a pool of workers and returns their stats in task order.
+func runCollectTasks(ctx context.Context, tasks []collectTask, workers int) []CollectionStat {
+	stats := make([]CollectionStat, len(tasks))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start := time.Now()
+				count, pages, err := tasks[i].run(ctx)
+				stats[i] = CollectionStat{
+					Kind:     tasks[i].kind,
+					Count:    count,
+					Pages:    pages,
+					Duration: time.Since(start).Round(time.Millisecond),
+				}
+				if err != nil {
+					stats[i].Error = err.Error()
+				}
+			}
+		}()
+	}
+	for i := range tasks {
+		jobs <- i
 	}
+	close(jobs)
+	wg.Wait()
 
-	// Remove from DaemonSets
-	for i := range cd.DaemonSets {
-		cd.DaemonSets[i].ManagedFields = nil
+	return stats
+}
+
+// metadataCountTask counts the objects of a kind through the metadata client without keeping them.
+func metadataCountTask(metadataClient metadata.Interface, gvr schema.GroupVersionResource, opts CollectOptions) func(ctx context.Context) (int, int, error) {
+	return func(ctx context.Context) (int, int, error) {
+		return listAll(ctx, opts, nil, func(ctx context.Context, lo metav1.ListOptions) ([]metav1.PartialObjectMetadata, string, error) {
+			l, err := metadataClient.Resource(gvr).Namespace(metav1.NamespaceAll).List(ctx, lo)
+			if err != nil {
+				return nil, "", err
+			}
+			return l.Items, l.Continue, nil
+		})
 	}
+}
 
-	// Remove from Jobs
-	for i := range cd.Jobs {
-		cd.Jobs[i].ManagedFields = nil
+// listAll follows Continue tokens page by page, bounding every call with opts.CallTimeout.
+// Managed fields are dropped from each page right away to keep memory low; with a nil
+// out the pages are only counted. When a Continue token expires (410 Gone) while
+// paging, the list restarts from the first page, up to maxListRestarts times.
+func listAll[T any](
+	ctx context.Context,
+	opts CollectOptions,
+	out *[]T,
+	list func(ctx context.Context, lo metav1.ListOptions) ([]T, string, error),
+) (int, int, error) {
+	base := 0
+	if out != nil {
+		base = len(*out)
 	}
+	lo := metav1.ListOptions{Limit: opts.PageSize}
+	count, pages, restarts := 0, 0, 0
+	for {
+		callCtx, cancel := context.WithTimeout(ctx, opts.CallTimeout)
+		items, cont, err := list(callCtx, lo)
+		cancel()
+		if err != nil {
+			if lo.Continue != "" && (apierrors.IsResourceExpired(err) || apierrors.IsGone(err)) && restarts < maxListRestarts {
+				restarts++
+				log.Printf("Continue token expired after %d pages, restarting the list (%d/%d)", pages, restarts, maxListRestarts)
+				lo.Continue = ""
+				count, pages = 0, 0
+				if out != nil {
+					*out = (*out)[:base]
+				}
+				continue
+			}
+			return count, pages, err
+		}
+		pages++
+		count += len(items)
+
+		if out != nil {
+			for i := range items {
+				if obj, ok := any(&items[i]).(metav1.Object); ok {
+					obj.SetManagedFields(nil)
+				}
+			}
+			*out = append(*out, items...)
+		}
 
-	// Remove from CronJobs
-	for i := range cd.CronJobs {
-		cd.CronJobs[i].ManagedFields = nil
+		if cont == "" {
+			return count, pages, nil
+		}
+		lo.Continue = cont
 	}
 }
 
@@ -208,6 +407,28 @@ func detectK8sDistribution(nodes []corev1.Node) string {
 	return "Unknown"
 }
 
+// nodePoolLabels are the well-known labels holding a node's pool / node group name.
+var nodePoolLabels = []string{
+	"eks.amazonaws.com/nodegroup",
+	"cloud.google.com/gke-nodepool",
+	"kubernetes.azure.com/agentpool",
+	"agentpool",
+	"doks.digitalocean.com/node-pool",
+	"karpenter.sh/nodepool",
+	"karpenter.sh/provisioner-name",
+	"node.kubernetes.io/pool",
+}
+
+// NodePool returns the node pool (node group) a node belongs to, or "" if unknown.
+func NodePool(node corev1.Node) string {
+	for _, label := range nodePoolLabels {
+		if pool := node.Labels[label]; pool != "" {
+			return pool
+		}
+	}
+	return ""
+}
+
 func gatherNodeInfoSummaries(summaries *NodeInfoSummary, nodes []corev1.Node) {
 	// Initialize all maps
 	summaries.OperatingSystemCounts = make(map[string]int)
@@ -0,0 +1,57 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestListAllRestartsOnExpiredContinue(t *testing.T) {
+	opts := CollectOptions{PageSize: 2, CallTimeout: time.Second}
+	expired := true
+	calls := 0
+	list := func(_ context.Context, lo metav1.ListOptions) ([]string, string, error) {
+		calls++
+		switch lo.Continue {
+		case "":
+			return []string{"a", "b"}, "page-2", nil
+		case "page-2":
+			if expired {
+				expired = false
+				return nil, "", apierrors.NewResourceExpired("continue token expired")
+			}
+			return []string{"c"}, "", nil
+		}
+		t.Fatalf("unexpected continue token %q", lo.Continue)
+		return nil, "", nil
+	}
+
+	out := []string{"existing"}
+	count, pages, err := listAll(context.Background(), opts, &out, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 || pages != 2 || calls != 4 {
+		t.Errorf("count=%d pages=%d calls=%d, want 3, 2, 4", count, pages, calls)
+	}
+	if want := []string{"existing", "a", "b", "c"}; len(out) != len(want) || out[1] != "a" || out[3] != "c" {
+		t.Errorf("out = %v, want %v", out, want)
+	}
+}
+
+func TestListAllGivesUpAfterRestarts(t *testing.T) {
+	opts := CollectOptions{PageSize: 1, CallTimeout: time.Second}
+	list := func(_ context.Context, lo metav1.ListOptions) ([]string, string, error) {
+		if lo.Continue == "" {
+			return []string{"a"}, "next", nil
+		}
+		return nil, "", apierrors.NewResourceExpired("continue token expired")
+	}
+
+	if _, _, err := listAll(context.Background(), opts, nil, list); !apierrors.IsResourceExpired(err) {
+		t.Errorf("err = %v, want the expired error after %d restarts", err, maxListRestarts)
+	}
+}
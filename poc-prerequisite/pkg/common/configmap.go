@@ -0,0 +1,362 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+)
+
+// DefaultConfigMapName is the ConfigMap the in-cluster run stores its files in.
+const DefaultConfigMapName = "kubescape-prerequisites-report"
+
+const (
+	// maxObjectBytes keeps every stored object below the 1 MiB object size limit, with room for the metadata.
+	maxObjectBytes = 1<<20 - 64<<10
+	// reportLabel marks every object of a report with the name of its first ConfigMap,
+	// so that parts left over by a larger previous run can be removed.
+	reportLabel = "kubescape.io/prerequisites-report"
+	// partsAnnotation lists the objects holding the rest of the report on the first ConfigMap.
+	partsAnnotation = "kubescape.io/report-parts"
+
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// OverflowMode selects where the files that do not fit into the first ConfigMap go.
+type OverflowMode string
+
+const (
+	// OverflowConfigMaps splits the files across further ConfigMaps <name>-2, <name>-3, ...
+	OverflowConfigMaps OverflowMode = "configmaps"
+	// OverflowSecret stores them in Secrets <name>-2, ..., e.g. to keep a full dump under Secret RBAC.
+	OverflowSecret OverflowMode = "secret"
+)
+
+// ParseOverflowMode validates the --configmap-overflow value.
+func ParseOverflowMode(value string) (OverflowMode, error) {
+	switch m := OverflowMode(value); m {
+	case OverflowConfigMaps, OverflowSecret:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid overflow mode %q (expected configmaps or secret)", value)
+	}
+}
+
+// ConfigMapOptions select where the in-cluster run stores its files.
+type ConfigMapOptions struct {
+	// Name of the first ConfigMap; default DefaultConfigMapName.
+	Name string
+	// Namespace defaults to the namespace of the pod, see PodNamespace.
+	Namespace string
+	Overflow  OverflowMode
+}
+
+// PodNamespace returns the namespace of the pod: $POD_NAMESPACE (set through the downward API),
+// else the namespace of its service account token, else "default".
+func PodNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	if b, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+		if ns := strings.TrimSpace(string(b)); ns != "" {
+			return ns
+		}
+	}
+	return "default"
+}
+
+// storedObject is one ConfigMap or Secret holding gzip'ed artifacts, or parts of them.
+type storedObject struct {
+	Name   string
+	Secret bool
+	Data   map[string][]byte
+	size   int
+}
+
+// storedPart locates one part of a stored artifact.
+type storedPart struct {
+	Object *storedObject
+	Key    string
+}
+
+func (o *storedObject) kind() string {
+	if o.Secret {
+		return "secret"
+	}
+	return "configmap"
+}
+
+// dataField is the field of the object the gzip'ed files are under.
+func (o *storedObject) dataField() string {
+	if o.Secret {
+		return "data"
+	}
+	return "binaryData"
+}
+
+// packArtifacts gzips the artifacts and distributes them over as many objects as needed.
+// Artifacts larger than an object are split into parts <file>.gz.000, <file>.gz.001, ...
+// which have to be concatenated in order before gunzip.
+func packArtifacts(artifacts []Artifact, opts ConfigMapOptions) ([]*storedObject, map[string][]storedPart, error) {
+	// Raw bytes that fit into an object once base64 encoded, next to a key of up to 253 bytes
+	chunkSize := (maxObjectBytes - 253) / 4 * 3
+	objects := []*storedObject{{Name: opts.Name, Data: map[string][]byte{}}}
+	parts := map[string][]storedPart{}
+
+	for _, a := range artifacts {
+		compressed, err := gzipBytes([]byte(a.Content))
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not compress %s: %w", a.FileName, err)
+		}
+		chunks := splitBytes(compressed, chunkSize)
+		for i, chunk := range chunks {
+			key := a.FileName + ".gz"
+			if len(chunks) > 1 {
+				key = fmt.Sprintf("%s.%03d", key, i)
+			}
+			size := base64.StdEncoding.EncodedLen(len(chunk)) + len(key)
+			current := objects[len(objects)-1]
+			if current.size+size > maxObjectBytes {
+				current = &storedObject{
+					Name:   fmt.Sprintf("%s-%d", opts.Name, len(objects)+1),
+					Secret: opts.Overflow == OverflowSecret,
+					Data:   map[string][]byte{},
+				}
+				objects = append(objects, current)
+			}
+			current.Data[key] = chunk
+			current.size += size
+			parts[a.FileName] = append(parts[a.FileName], storedPart{Object: current, Key: key})
+		}
+	}
+	return objects, parts, nil
+}
+
+func gzipBytes(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(content); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func splitBytes(b []byte, size int) [][]byte {
+	var chunks [][]byte
+	for len(b) > size {
+		chunks = append(chunks, b[:size])
+		b = b[size:]
+	}
+	return append(chunks, b)
+}
+
+// WriteToConfigMap stores the artifacts gzip'ed in the binaryData of a ConfigMap, spilling over
+// into further ConfigMaps or Secrets when they exceed the object size limit.
+func WriteToConfigMap(artifacts []Artifact, opts ConfigMapOptions) error {
+	if opts.Name == "" {
+		opts.Name = DefaultConfigMapName
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = PodNamespace()
+	}
+	if opts.Overflow == "" {
+		opts.Overflow = OverflowConfigMaps
+	}
+
+	// Build in-cluster Kubernetes client configuration
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return fmt.Errorf("failed to build in-cluster config: %w", err)
+	}
+
+	// Create clientset
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	objects, parts, err := packArtifacts(artifacts, opts)
+	if err != nil {
+		return fmt.Errorf("failed to prepare the report objects: %w", err)
+	}
+
+	ctx := context.Background()
+	var overflow []string
+	for _, o := range objects[1:] {
+		overflow = append(overflow, o.kind()+"/"+o.Name)
+	}
+	for i, o := range objects {
+		meta := metav1.ObjectMeta{
+			Name:      o.Name,
+			Namespace: opts.Namespace,
+			Labels:    map[string]string{reportLabel: opts.Name},
+		}
+		if i == 0 {
+			meta.Annotations = map[string]string{partsAnnotation: strings.Join(overflow, ",")}
+		}
+		if o.Secret {
+			err = applySecret(ctx, clientset, &corev1.Secret{ObjectMeta: meta, Type: corev1.SecretTypeOpaque, Data: o.Data})
+		} else {
+			err = applyConfigMap(ctx, clientset, &corev1.ConfigMap{ObjectMeta: meta, BinaryData: o.Data})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to store %s %s/%s: %w", o.kind(), opts.Namespace, o.Name, err)
+		}
+	}
+	deleteStaleParts(ctx, clientset, opts, objects)
+
+	printConfigMapSuccess(artifacts, parts, opts.Namespace)
+	return nil
+}
+
+// applyConfigMap creates the ConfigMap or replaces the content of the existing one,
+// retrying when another writer updated it in between.
+func applyConfigMap(ctx context.Context, clientset kubernetes.Interface, desired *corev1.ConfigMap) error {
+	client := clientset.CoreV1().ConfigMaps(desired.Namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := client.Get(ctx, desired.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = client.Create(ctx, desired, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Created concurrently: retry as an update
+				return apierrors.NewConflict(corev1.Resource("configmaps"), desired.Name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		existing.Labels = mergeLabels(existing.Labels, desired.Labels)
+		existing.Annotations = mergeLabels(existing.Annotations, desired.Annotations)
+		existing.Data = desired.Data
+		existing.BinaryData = desired.BinaryData
+		_, err = client.Update(ctx, existing, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// applySecret is applyConfigMap for Secrets.
+func applySecret(ctx context.Context, clientset kubernetes.Interface, desired *corev1.Secret) error {
+	client := clientset.CoreV1().Secrets(desired.Namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := client.Get(ctx, desired.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = client.Create(ctx, desired, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(corev1.Resource("secrets"), desired.Name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		existing.Labels = mergeLabels(existing.Labels, desired.Labels)
+		existing.Data = desired.Data
+		_, err = client.Update(ctx, existing, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func mergeLabels(existing, desired map[string]string) map[string]string {
+	if existing == nil {
+		existing = map[string]string{}
+	}
+	for k, v := range desired {
+		existing[k] = v
+	}
+	return existing
+}
+
+// deleteStaleParts removes the overflow objects of a previous, larger report. Failures are only
+// logged: the first ConfigMap lists the current parts, so leftovers are harmless.
+func deleteStaleParts(ctx context.Context, clientset kubernetes.Interface, opts ConfigMapOptions, objects []*storedObject) {
+	current := map[string]bool{}
+	for _, o := range objects {
+		current[o.kind()+"/"+o.Name] = true
+	}
+	selector := metav1.ListOptions{LabelSelector: reportLabel + "=" + opts.Name}
+
+	if list, err := clientset.CoreV1().ConfigMaps(opts.Namespace).List(ctx, selector); err != nil {
+		log.Printf("Could not list previous report ConfigMaps: %v", err)
+	} else {
+		for _, cm := range list.Items {
+			if !current["configmap/"+cm.Name] {
+				if err := clientset.CoreV1().ConfigMaps(opts.Namespace).Delete(ctx, cm.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+					log.Printf("Could not delete stale ConfigMap %s: %v", cm.Name, err)
+				}
+			}
+		}
+	}
+	if list, err := clientset.CoreV1().Secrets(opts.Namespace).List(ctx, selector); err != nil {
+		if opts.Overflow == OverflowSecret {
+			log.Printf("Could not list previous report Secrets: %v", err)
+		}
+	} else {
+		for _, s := range list.Items {
+			if !current["secret/"+s.Name] {
+				if err := clientset.CoreV1().Secrets(opts.Namespace).Delete(ctx, s.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+					log.Printf("Could not delete stale Secret %s: %v", s.Name, err)
+				}
+			}
+		}
+	}
+}
+
+// exportCommand is the shell command restoring fileName from its stored parts.
+func exportCommand(fileName string, parts []storedPart, namespace string) string {
+	var reads []string
+	for _, p := range parts {
+		reads = append(reads, fmt.Sprintf("kubectl get %s %s -n %s -o go-template='{{ index .%s \"%s\" }}' | base64 -d",
+			p.Object.kind(), p.Object.Name, namespace, p.Object.dataField(), p.Key))
+	}
+	if len(reads) == 1 {
+		return reads[0] + " | gunzip > " + fileName
+	}
+	return "{ " + strings.Join(reads, "; ") + "; } | gunzip > " + fileName
+}
+
+func printConfigMapSuccess(artifacts []Artifact, parts map[string][]storedPart, namespace string) {
+	names := map[string]bool{}
+	for _, fileParts := range parts {
+		for _, p := range fileParts {
+			names[p.Object.kind()+"/"+p.Object.Name] = true
+		}
+	}
+	objects := make([]string, 0, len(names))
+	for name := range names {
+		objects = append(objects, name)
+	}
+	sort.Strings(objects)
+
+	printSeparator()
+	fmt.Fprintln(Console, "✅ prerequisites report stored in Kubernetes ConfigMap!")
+	fmt.Fprintln(Console, "   • Objects:", strings.Join(objects, ", "))
+	fmt.Fprintln(Console, "   • Namespace:", namespace)
+	printSeparator()
+	fmt.Fprintln(Console, "")
+	fmt.Fprintln(Console, "⬇️  To export the report files locally:")
+	for _, a := range artifacts {
+		fmt.Fprintln(Console, "   ", exportCommand(a.FileName, parts[a.FileName], namespace))
+	}
+	fmt.Fprintln(Console, "")
+	if hasArtifact(artifacts, HTMLReportFile) {
+		fmt.Fprintln(Console, "📋 Open", HTMLReportFile, "in your browser for details.")
+	}
+	printHelmInstructions()
+	printSeparator()
+}
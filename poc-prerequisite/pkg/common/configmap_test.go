@@ -0,0 +1,97 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+func gunzip(t *testing.T, b []byte) string {
+	t.Helper()
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// incompressible returns n bytes of hex text that gzip cannot shrink below about n/2.
+func incompressible(t *testing.T, n int) string {
+	t.Helper()
+	b := make([]byte, n/2)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func TestPackArtifacts(t *testing.T) {
+	large := incompressible(t, 4*maxObjectBytes)
+	tests := []struct {
+		name        string
+		artifacts   []Artifact
+		overflow    OverflowMode
+		wantObjects int
+		wantSecrets bool
+	}{
+		{
+			name:        "small files share the first ConfigMap",
+			artifacts:   []Artifact{{FileName: ValuesFile, Content: "a: 1\n"}, {FileName: HTMLReportFile, Content: "<html></html>"}},
+			overflow:    OverflowConfigMaps,
+			wantObjects: 1,
+		},
+		{
+			name:        "large file is split into ConfigMap parts",
+			artifacts:   []Artifact{{FileName: ValuesFile, Content: "a: 1\n"}, {FileName: "full-cluster-dump.yaml", Content: large}},
+			overflow:    OverflowConfigMaps,
+			wantObjects: 3,
+		},
+		{
+			name:        "overflow into Secrets",
+			artifacts:   []Artifact{{FileName: ValuesFile, Content: "a: 1\n"}, {FileName: "full-cluster-dump.yaml", Content: large}},
+			overflow:    OverflowSecret,
+			wantObjects: 3,
+			wantSecrets: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, parts, err := packArtifacts(tt.artifacts, ConfigMapOptions{Name: "report", Overflow: tt.overflow})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(objects) != tt.wantObjects {
+				t.Errorf("got %d objects, want %d", len(objects), tt.wantObjects)
+			}
+			for i, o := range objects {
+				if o.size > maxObjectBytes {
+					t.Errorf("object %s holds %d bytes, above %d", o.Name, o.size, maxObjectBytes)
+				}
+				if wantSecret := i > 0 && tt.wantSecrets; o.Secret != wantSecret {
+					t.Errorf("object %s: secret = %v, want %v", o.Name, o.Secret, wantSecret)
+				}
+			}
+			if objects[0].Name != "report" || (len(objects) > 1 && objects[1].Name != "report-2") {
+				t.Errorf("unexpected object names %q, %q", objects[0].Name, objects[len(objects)-1].Name)
+			}
+
+			// Concatenating the parts in order restores every file
+			for _, a := range tt.artifacts {
+				var joined []byte
+				for _, p := range parts[a.FileName] {
+					joined = append(joined, p.Object.Data[p.Key]...)
+				}
+				if got := gunzip(t, joined); got != a.Content {
+					t.Errorf("%s: restored %d bytes, want %d", a.FileName, len(got), len(a.Content))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// DumpFormatVersion marks full-cluster-dump.yaml files in the current encoding.
+// Change it whenever a field of ClusterData is renamed or changes meaning.
+const DumpFormatVersion = "armo-prerequisite-dump/v1"
+
+// LoadClusterData reads a full-cluster-dump.yaml written by BuildFullDumpYAML, or a
+// `kubectl get -A -o yaml` export (one or more documents, List or single objects),
+// and derives the node summaries so sizing and the passive checks can run offline.
+func LoadClusterData(path string) (*ClusterData, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cd := &ClusterData{}
+	fromExport := false
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(content), 4096)
+	for {
+		var doc json.RawMessage
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(doc) == 0 || string(doc) == "null" {
+			continue
+		}
+
+		var header struct {
+			Kind       string `json:"kind"`
+			DumpFormat string `json:"dumpFormat"`
+		}
+		if err := json.Unmarshal(doc, &header); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if header.Kind == "" {
+			// A full-cluster-dump.yaml. Older dumps used other keys and would decode
+			// into empty nodes and counts, so they are rejected rather than guessed.
+			if header.DumpFormat != DumpFormatVersion {
+				if header.DumpFormat == "" {
+					return nil, fmt.Errorf("%s: neither a Kubernetes export nor a cluster dump in format %s; dumps written by older checker versions cannot be replayed, collect a new one", path, DumpFormatVersion)
+				}
+				return nil, fmt.Errorf("%s: unsupported cluster dump format %q, this checker reads %s", path, header.DumpFormat, DumpFormatVersion)
+			}
+			if err := json.Unmarshal(doc, cd); err != nil {
+				return nil, fmt.Errorf("%s: not a cluster dump: %w", path, err)
+			}
+			continue
+		}
+		fromExport = true
+		if err := addExportedObject(cd, header.Kind, doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if fromExport {
+		cd.ClusterDetails.Version = "unknown"
+		cd.ResourceCounts = nil
+	}
+	if len(cd.ResourceCounts) == 0 {
+		cd.ResourceCounts = map[string]int{
+			"nodes":        len(cd.Nodes),
+			"pods":         len(cd.Pods),
+			"services":     len(cd.Services),
+			"deployments":  len(cd.Deployments),
+			"replicasets":  len(cd.ReplicaSets),
+			"statefulsets": len(cd.StatefulSets),
+			"daemonsets":   len(cd.DaemonSets),
+			"jobs":         len(cd.Jobs),
+			"cronjobs":     len(cd.CronJobs),
+		}
+	}
+	if len(cd.Nodes) == 0 {
+		log.Printf("%s contains no nodes: node sizing falls back to the defaults", path)
+	}
+
+	summarizeNodes(cd)
+	cd.Source = path
+	return cd, nil
+}
+
+// addExportedObject appends one object (or every item of a List) of a kubectl export to cd.
+// Kinds that sizing does not use are ignored.
+func addExportedObject(cd *ClusterData, kind string, doc []byte) error {
+	if strings.HasSuffix(kind, "List") {
+		var list struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(doc, &list); err != nil {
+			return err
+		}
+		for _, item := range list.Items {
+			var header struct {
+				Kind string `json:"kind"`
+			}
+			if err := json.Unmarshal(item, &header); err != nil {
+				return err
+			}
+			if err := addExportedObject(cd, header.Kind, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch kind {
+	case "Node":
+		return appendDecoded(doc, &cd.Nodes)
+	case "Pod":
+		return appendDecoded(doc, &cd.Pods)
+	case "Service":
+		return appendDecoded(doc, &cd.Services)
+	case "Deployment":
+		return appendDecoded(doc, &cd.Deployments)
+	case "ReplicaSet":
+		return appendDecoded(doc, &cd.ReplicaSets)
+	case "StatefulSet":
+		return appendDecoded(doc, &cd.StatefulSets)
+	case "DaemonSet":
+		return appendDecoded(doc, &cd.DaemonSets)
+	case "Job":
+		return appendDecoded(doc, &cd.Jobs)
+	case "CronJob":
+		return appendDecoded(doc, &cd.CronJobs)
+	default:
+		return nil
+	}
+}
+
+func appendDecoded[T any](doc []byte, out *[]T) error {
+	var obj T
+	if err := json.Unmarshal(doc, &obj); err != nil {
+		return err
+	}
+	*out = append(*out, obj)
+	return nil
+}
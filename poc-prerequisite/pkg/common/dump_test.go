@@ -0,0 +1,60 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLoadClusterDataRejectsLegacyDump(t *testing.T) {
+	cd, err := LoadClusterData(filepath.Join("testdata", "legacy-dump.yaml"))
+	if err == nil {
+		t.Fatalf("legacy dump loaded with %d nodes, want an error", len(cd.Nodes))
+	}
+	if !strings.Contains(err.Error(), DumpFormatVersion) || !strings.Contains(err.Error(), "older checker versions") {
+		t.Errorf("error %q does not report a dump from an older checker", err)
+	}
+}
+
+func TestLoadClusterDataRejectsOtherFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.yaml")
+	if err := os.WriteFile(path, []byte("dumpFormat: armo-prerequisite-dump/v99\nnodes: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadClusterData(path); err == nil || !strings.Contains(err.Error(), "v99") {
+		t.Errorf("err = %v, want an unsupported format error", err)
+	}
+}
+
+func TestLoadClusterDataRoundTrip(t *testing.T) {
+	cd := &ClusterData{
+		Nodes: []corev1.Node{{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: corev1.NodeStatus{Capacity: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("8"),
+				corev1.ResourceMemory: resource.MustParse("32Gi"),
+			}},
+		}},
+		ClusterDetails: ClusterDetails{Name: "prod-eu", Version: "v1.29.4"},
+	}
+	path := filepath.Join(t.TempDir(), "full-cluster-dump.yaml")
+	if err := os.WriteFile(path, []byte(BuildFullDumpYAML(cd)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadClusterData(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Nodes) != 1 || loaded.Nodes[0].Status.Capacity.Cpu().Value() != 8 {
+		t.Errorf("nodes not restored: %+v", loaded.Nodes)
+	}
+	if loaded.ClusterDetails.Version != "v1.29.4" {
+		t.Errorf("version = %q, want v1.29.4", loaded.ClusterDetails.Version)
+	}
+}
@@ -3,13 +3,16 @@ package common
 import (
 	"fmt"
 	"html/template"
+	"sort"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
+	sigsyaml "sigs.k8s.io/yaml"
 )
 
-func BuildReportData(cd *ClusterData, sr *SizingResult) *ReportData {
+func BuildReportData(cd *ClusterData, sr *SizingResult, checkResults []CheckResult) *ReportData {
+	now := time.Now()
 	report := &ReportData{
 		// existing merges:
 		TotalResources:             sr.TotalResources,
@@ -25,9 +28,21 @@ func BuildReportData(cd *ClusterData, sr *SizingResult) *ReportData {
 		K8sDistribution:   cd.ClusterDetails.K8sDistribution,
 		TotalNodeCount:    cd.ClusterDetails.TotalNodeCount,
 		TotalVCPUCount:    cd.ClusterDetails.TotalVCPUCount,
+		ClusterName:       cd.ClusterDetails.Name,
 
-		GenerationTime:  time.Now().Format("2006-01-02 15:04:05"),
+		GenerationTime:  now.Format("2006-01-02 15:04:05"),
+		GeneratedAt:     now,
+		DataSource:      cd.Source,
 		FullClusterData: cd,
+		CheckResults:    checkResults,
+
+		CollectionStats:     cd.CollectionStats,
+		CollectionDuration:  cd.CollectionDuration.Round(time.Millisecond).String(),
+		SizingAccuracyNotes: sr.AccuracyNotes,
+	}
+
+	for _, kind := range cd.MissingKinds() {
+		report.MissingData = append(report.MissingData, MissingData{Kind: kind, Error: cd.CollectionErrors[kind]})
 	}
 
 	// Now populate the node info summary fields:
@@ -42,14 +57,28 @@ func BuildReportData(cd *ClusterData, sr *SizingResult) *ReportData {
 	report.NodeKubeletVersionSummary = summarizeMap(ni.KubeletVersionCounts, totalNodes)
 	report.NodeKubeProxyVersionSummary = summarizeMap(ni.KubeProxyVersionCounts, totalNodes)
 
+	// Collect the Helm values recommended by checks
+	for _, r := range checkResults {
+		for key, val := range r.RecommendedValues {
+			if report.RecommendedValues == nil {
+				report.RecommendedValues = map[string]string{}
+			}
+			report.RecommendedValues[key] = val
+		}
+	}
+
 	return report
 }
 
+// BuildFullDumpYAML serializes cd with the Kubernetes JSON field names (so quantities,
+// timestamps etc. survive) for LoadClusterData to read back.
 func BuildFullDumpYAML(cd *ClusterData) string {
 	if cd == nil {
 		return "Error building full cluster dump: cluster data is nil"
 	}
-	y, err := yaml.Marshal(cd)
+	dump := *cd
+	dump.DumpFormat = DumpFormatVersion
+	y, err := sigsyaml.Marshal(&dump)
 	if err != nil {
 		return fmt.Sprintf("Error building full cluster dump: %v", err)
 	}
@@ -109,18 +138,43 @@ func BuildValuesYAML(d *ReportData) string {
 	}
 
 	// If no overrides, just return a comment
-	if len(overrides) == 0 {
+	if len(overrides) == 0 && len(d.RecommendedValues) == 0 {
 		return "# no adjustments are required for the default values\n"
 	}
 
+	// Split the values recommended by checks per top-level component
+	extras := map[string]map[string]string{}
+	for key, val := range d.RecommendedValues {
+		comp, field, ok := strings.Cut(key, ".")
+		if !ok {
+			continue
+		}
+		if extras[comp] == nil {
+			extras[comp] = map[string]string{}
+		}
+		extras[comp][field] = val
+	}
+
 	// Build the partial YAML for each known component
 	var sb strings.Builder
 	sb.WriteString(buildYamlSection("nodeAgent", overrides,
-		[]string{"requests.cpu", "requests.memory", "limits.cpu", "limits.memory"}))
+		[]string{"requests.cpu", "requests.memory", "limits.cpu", "limits.memory"}, extras["nodeAgent"]))
 	sb.WriteString(buildYamlSection("storage", overrides,
-		[]string{"requests.memory", "limits.memory"}))
+		[]string{"requests.memory", "limits.memory"}, extras["storage"]))
 	sb.WriteString(buildYamlSection("kubevuln", overrides,
-		[]string{"requests.memory", "limits.memory"}))
+		[]string{"requests.memory", "limits.memory"}, extras["kubevuln"]))
+
+	// Components only touched by checks
+	var others []string
+	for comp := range extras {
+		if comp != "nodeAgent" && comp != "storage" && comp != "kubevuln" {
+			others = append(others, comp)
+		}
+	}
+	sort.Strings(others)
+	for _, comp := range others {
+		sb.WriteString(buildYamlSection(comp, overrides, nil, extras[comp]))
+	}
 
 	return sb.String()
 }
@@ -131,13 +185,39 @@ func addIfOverride(overrides map[string]string, key, defaultVal, finalVal string
 	}
 }
 
-func buildYamlSection(componentName string, overrides map[string]string, keys []string) string {
+func buildYamlSection(componentName string, overrides map[string]string, keys []string, extras map[string]string) string {
 	fields := map[string]string{}
 	for _, k := range keys {
 		fullKey := fmt.Sprintf("%s.resources.%s", componentName, k)
 		fields[k] = overrides[fullKey]
 	}
-	return buildComponentSection(componentName, "resources", fields)
+	resources := buildComponentSection(componentName, "resources", fields)
+	if len(extras) == 0 {
+		return resources
+	}
+
+	// Merge check-recommended fields into the same component block
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s:\n", componentName))
+	extraKeys := make([]string, 0, len(extras))
+	for k := range extras {
+		extraKeys = append(extraKeys, k)
+	}
+	sort.Strings(extraKeys)
+	for _, k := range extraKeys {
+		sb.WriteString(fmt.Sprintf("  %s: %s\n", k, yamlScalar(extras[k])))
+	}
+	sb.WriteString(strings.TrimPrefix(resources, componentName+":\n"))
+	return sb.String()
+}
+
+// yamlScalar quotes a value when needed to keep it a plain YAML string.
+func yamlScalar(val string) string {
+	out, err := yaml.Marshal(val)
+	if err != nil {
+		return fmt.Sprintf("%q", val)
+	}
+	return strings.TrimSuffix(string(out), "\n")
 }
 
 // buildComponentSection is the final sub-snippet for generating the partial YAML
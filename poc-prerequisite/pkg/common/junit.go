@@ -0,0 +1,125 @@
+package common
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const junitSuiteName = "kubescape-prerequisites"
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// BuildJUnitReport maps every check to a JUnit test case: fail to <failure>, error to <error>,
+// skip to <skipped>. JUnit has no warning state, so warnings pass with the reason in <system-out>.
+func BuildJUnitReport(report *ReportData) (string, error) {
+	suite := junitTestSuite{
+		Name:      junitSuiteName,
+		Timestamp: report.GeneratedAt.UTC().Format(time.RFC3339),
+		Properties: []junitProperty{
+			{Name: "kubernetesVersion", Value: report.KubernetesVersion},
+			{Name: "cloudProvider", Value: report.CloudProvider},
+			{Name: "distribution", Value: report.K8sDistribution},
+			{Name: "nodeCount", Value: fmt.Sprint(report.TotalNodeCount)},
+		},
+	}
+
+	for _, r := range report.CheckResults {
+		tc := junitTestCase{
+			ClassName: junitSuiteName + "." + string(r.Type),
+			Name:      r.Name,
+		}
+		switch r.Status {
+		case StatusFail:
+			tc.Failure = &junitMessage{Message: r.Reason, Type: string(r.Severity), Text: checkResultText(r)}
+			suite.Failures++
+		case StatusError:
+			tc.Error = &junitMessage{Message: r.Reason, Text: checkResultText(r)}
+			suite.Errors++
+		case StatusSkip:
+			tc.Skipped = &junitMessage{Message: r.StatusLabel()}
+			suite.Skipped++
+		case StatusWarn:
+			tc.SystemOut = "WARNING: " + checkResultText(r)
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+		suite.Tests++
+	}
+
+	suites := junitTestSuites{
+		Name:     junitSuiteName,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Skipped:  suite.Skipped,
+		Suites:   []junitTestSuite{suite},
+	}
+	b, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return xml.Header + string(b) + "\n", nil
+}
+
+// checkResultText is the plain-text body of a check result for CI reports.
+func checkResultText(r CheckResult) string {
+	var sb strings.Builder
+	if r.Reason != "" {
+		sb.WriteString(r.Reason + "\n")
+	}
+	for _, e := range r.Evidence {
+		sb.WriteString("- " + e.Kind + " ")
+		if e.Namespace != "" {
+			sb.WriteString(e.Namespace + "/")
+		}
+		sb.WriteString(e.Name)
+		if e.Detail != "" {
+			sb.WriteString(": " + e.Detail)
+		}
+		sb.WriteString("\n")
+	}
+	if r.Remediation != "" {
+		sb.WriteString("Remediation: " + r.Remediation + "\n")
+	}
+	return sb.String()
+}
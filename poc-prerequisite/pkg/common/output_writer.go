@@ -1,127 +1,321 @@
 package common
 
 import (
-	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
-
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"regexp"
+	"strings"
 )
 
+// Console receives the human-readable output; it is switched to stderr when an artifact is streamed to stdout.
+var Console io.Writer = os.Stdout
+
 func printSeparator() {
-	fmt.Println("------------------------------------------------------------")
+	fmt.Fprintln(Console, "------------------------------------------------------------")
 }
 
 func printHelmInstructions() {
-	fmt.Println("🚀 Use the generated recommended-values.yaml to optimize Kubescape for your cluster.")
+	fmt.Fprintln(Console, "🚀 Use the generated recommended-values.yaml to optimize Kubescape for your cluster.")
 }
 
-func printDiskSuccess(reportPath, valuesPath, dumpPath string) {
-	printSeparator()
-	fmt.Println("✅ prerequisites report generated locally!")
-	fmt.Println("   •", reportPath, "(HTML report)")
-	fmt.Println("   •", valuesPath, "(Helm values file)")
-	fmt.Println("   •", dumpPath, "(Full cluster dump)")
-	fmt.Println("")
-	fmt.Println("📋 Open", reportPath, "in your browser for details.")
-	printHelmInstructions()
+func printMissingData(report *ReportData) {
+	if len(report.MissingData) == 0 {
+		return
+	}
 	printSeparator()
+	fmt.Fprintln(Console, "⚠️  Some cluster data could not be collected:")
+	for _, m := range report.MissingData {
+		fmt.Fprintf(Console, "   • %s: %s\n", m.Kind, m.Error)
+	}
+	for _, note := range report.SizingAccuracyNotes {
+		fmt.Fprintln(Console, "   ", note)
+	}
 }
 
-func printConfigMapSuccess() {
+func printDiskSuccess(dir string, artifacts []Artifact) {
 	printSeparator()
-	fmt.Println("✅ prerequisites report stored in Kubernetes ConfigMap!")
-	fmt.Println("   • ConfigMap Name: kubescape-prerequisites-report")
-	fmt.Println("   • Namespace: default")
-	printSeparator()
-	fmt.Println("")
-	fmt.Println("⬇️  To export the report files locally:")
-	fmt.Println("    kubectl get configmap kubescape-prerequisites-report -n default -o go-template='{{ index .data \"prerequisites-report.html\" }}' > prerequisites-report.html")
-	fmt.Println("    kubectl get configmap kubescape-prerequisites-report -n default -o go-template='{{ index .data \"recommended-values.yaml\" }}' > recommended-values.yaml")
-	fmt.Println("    kubectl get configmap kubescape-prerequisites-report -n default -o go-template='{{ index .data \"full-cluster-dump.yaml\" }}' > full-cluster-dump.yaml")
-	fmt.Println("")
-	fmt.Println("📋 Open prerequisites-report.html in your browser for details.")
+	fmt.Fprintln(Console, "✅ prerequisites report generated locally!")
+	for _, a := range artifacts {
+		fmt.Fprintln(Console, "   •", filepath.Join(dir, a.FileName), "("+a.Description+")")
+	}
+	fmt.Fprintln(Console, "")
+	if hasArtifact(artifacts, HTMLReportFile) {
+		fmt.Fprintln(Console, "📋 Open", filepath.Join(dir, HTMLReportFile), "in your browser for details.")
+	}
 	printHelmInstructions()
 	printSeparator()
 }
 
-func WriteToDisk(htmlContent, helmValuesContent, fullDumpContent string) {
-	// 1) Write the HTML report
-	reportPath := filepath.Join(os.TempDir(), "prerequisites-report.html")
-	if err := os.WriteFile(reportPath, []byte(htmlContent), 0644); err != nil {
-		log.Fatalf("Could not write HTML report: %v", err)
+func hasArtifact(artifacts []Artifact, fileName string) bool {
+	for _, a := range artifacts {
+		if a.FileName == fileName {
+			return true
+		}
 	}
+	return false
+}
 
-	// 2) Write the recommended values YAML
-	valuesPath := filepath.Join(os.TempDir(), "recommended-values.yaml")
-	if err := os.WriteFile(valuesPath, []byte(helmValuesContent), 0644); err != nil {
-		log.Fatalf("Could not write recommended-values.yaml: %v", err)
+// WriteToDisk writes the artifacts into dir, the system temp directory when empty.
+// With bundle, a manifest, a SHA256SUMS file and a .tar.gz of every file are added; its path is returned.
+func WriteToDisk(dir string, artifacts []Artifact, bundle *BundleInfo) (string, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("could not create output directory %s: %w", dir, err)
 	}
 
-	// 3) Write the full cluster dump
-	dumpPath := filepath.Join(os.TempDir(), "full-cluster-dump.yaml")
-	if err := os.WriteFile(dumpPath, []byte(fullDumpContent), 0644); err != nil {
-		log.Fatalf("Could not write full-cluster-dump.yaml: %v", err)
+	for _, a := range artifacts {
+		if err := os.WriteFile(filepath.Join(dir, a.FileName), []byte(a.Content), 0644); err != nil {
+			return "", fmt.Errorf("could not write %s: %w", a.FileName, err)
+		}
 	}
 
-	// 4) Print success messages and instructions for local disk
-	printDiskSuccess(reportPath, valuesPath, dumpPath)
-}
+	var bundlePath string
+	if bundle != nil {
+		manifest, err := BuildManifest(*bundle, artifacts)
+		if err != nil {
+			return "", fmt.Errorf("could not build %s: %w", ManifestFile, err)
+		}
+		artifacts = append(artifacts, manifest)
+		checksums := BuildChecksums(artifacts)
+		artifacts = append(artifacts, checksums)
+		for _, a := range []Artifact{manifest, checksums} {
+			if err := os.WriteFile(filepath.Join(dir, a.FileName), []byte(a.Content), 0644); err != nil {
+				return "", fmt.Errorf("could not write %s: %w", a.FileName, err)
+			}
+		}
+		if bundlePath, err = WriteBundle(dir, bundle.RunName, artifacts); err != nil {
+			return "", fmt.Errorf("could not write the bundle: %w", err)
+		}
+	}
 
-func WriteToConfigMap(htmlContent, helmValuesContent, fullDumpContent string) {
-	// Build in-cluster Kubernetes client configuration
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		log.Fatalf("Failed to build in-cluster config: %v", err)
+	printDiskSuccess(dir, artifacts)
+	if bundlePath != "" {
+		fmt.Fprintln(Console, "📦 Bundle with all files:", bundlePath)
+		printSeparator()
 	}
+	return bundlePath, nil
+}
 
-	// Create clientset
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		log.Fatalf("Failed to create Kubernetes client: %v", err)
+// WriteClustersSummary writes the multi-cluster summary report into dir and returns its path.
+func WriteClustersSummary(dir, htmlContent string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("could not create output directory %s: %w", dir, err)
 	}
+	summaryPath := filepath.Join(dir, "clusters-summary.html")
+	if err := os.WriteFile(summaryPath, []byte(htmlContent), 0644); err != nil {
+		return "", fmt.Errorf("could not write clusters summary: %w", err)
+	}
+
+	printSeparator()
+	fmt.Fprintln(Console, "✅ clusters summary generated locally!")
+	fmt.Fprintln(Console, "   •", summaryPath, "(HTML summary)")
+	fmt.Fprintln(Console, "")
+	fmt.Fprintln(Console, "📋 Open", summaryPath, "in your browser to compare the clusters.")
+	printSeparator()
+	return summaryPath, nil
+}
+
+// Artifact file names.
+const (
+	HTMLReportFile = "prerequisites-report.html"
+	JSONReportFile = "prerequisites-report.json"
+	JUnitFile      = "prerequisites-junit.xml"
+	SARIFFile      = "prerequisites-report.sarif"
+	MarkdownFile   = "prerequisites-summary.md"
+	ValuesFile     = "recommended-values.yaml"
+	DumpFile       = "full-cluster-dump.yaml"
+)
+
+// Artifact is one file produced by a run.
+type Artifact struct {
+	// Kind names the artifact for --stdout: an OutputFormat, "values" or "dump".
+	Kind        string
+	FileName    string
+	Description string
+	Content     string
+}
+
+// OutputFormat is a report format selected with --output-format.
+type OutputFormat string
 
-	configMapName := "kubescape-prerequisites-report"
-	namespace := "default"
+const (
+	FormatHTML  OutputFormat = "html"
+	FormatJSON  OutputFormat = "json"
+	FormatJUnit OutputFormat = "junit"
+	FormatSARIF OutputFormat = "sarif"
+	// FormatMarkdown is the terminal summary as Markdown.
+	FormatMarkdown OutputFormat = "markdown"
+)
 
-	configMap := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      configMapName,
-			Namespace: namespace,
-		},
-		Data: map[string]string{
-			"prerequisites-report.html": htmlContent,
-			"recommended-values.yaml":   helmValuesContent,
-			"full-cluster-dump.yaml":    fullDumpContent,
-		},
+// ParseOutputFormats parses a comma-separated list of report formats.
+func ParseOutputFormats(value string) ([]OutputFormat, error) {
+	var formats []OutputFormat
+	for _, item := range strings.Split(value, ",") {
+		switch f := OutputFormat(strings.TrimSpace(item)); f {
+		case "":
+		case FormatHTML, FormatJSON, FormatJUnit, FormatSARIF, FormatMarkdown:
+			formats = append(formats, f)
+		default:
+			return nil, fmt.Errorf("invalid output format %q (expected html, json, junit, sarif or markdown)", item)
+		}
+	}
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("no output format selected")
 	}
+	return formats, nil
+}
 
-	// Create or Update
-	_, err = clientset.CoreV1().ConfigMaps(namespace).Create(context.Background(), configMap, metav1.CreateOptions{})
+// Artifact kinds besides the report formats.
+const (
+	ArtifactValues    = "values"
+	ArtifactDump      = "dump"
+	ArtifactManifest  = "manifest"
+	ArtifactChecksums = "checksums"
+)
+
+// OutputOptions selects the optional artifacts.
+type OutputOptions struct {
+	// Formats are the report formats to write; default: HTML only.
+	Formats []OutputFormat
+	// DumpLevel selects the content of full-cluster-dump.yaml; "" or none writes no dump.
+	DumpLevel DumpLevel
+	// Redactor is required with DumpLevelRedacted.
+	Redactor *Redactor
+	// Color enables ANSI colors in the terminal summary.
+	Color bool
+	// Dir is where the files are written (default: the temp directory). In the cluster,
+	// the files go to a ConfigMap unless Dir is set.
+	Dir string
+	// RunSubdir writes each run into its own "<timestamp>-<cluster>" subdirectory of Dir.
+	RunSubdir bool
+	// Stdout is the kind of the artifact also streamed to stdout, e.g. "json" or "values".
+	Stdout string
+	// Bundle adds a checksum manifest and a .tar.gz of all files.
+	Bundle bool
+	// ConfigMap is where the in-cluster run stores the files.
+	ConfigMap ConfigMapOptions
+}
+
+// BuildArtifacts renders every artifact selected by opts. It also records the dump level
+// and redaction rules in the report, so the reports state what the dump contains.
+func BuildArtifacts(sizingReportData *ReportData, opts OutputOptions) ([]Artifact, error) {
+	fullDumpContent, err := BuildDumpYAML(sizingReportData.FullClusterData, opts.DumpLevel, opts.Redactor)
 	if err != nil {
-		log.Printf("Failed to create ConfigMap: %v", err)
-		_, err = clientset.CoreV1().ConfigMaps(namespace).Update(context.Background(), configMap, metav1.UpdateOptions{})
-		if err != nil {
-			log.Fatalf("Failed to update ConfigMap: %v", err)
+		return nil, fmt.Errorf("could not build the cluster dump: %w", err)
+	}
+	sizingReportData.DumpLevel = opts.DumpLevel
+	if sizingReportData.DumpLevel == "" {
+		sizingReportData.DumpLevel = DumpLevelNone
+	}
+	if opts.DumpLevel == DumpLevelRedacted {
+		sizingReportData.RedactionRules = opts.Redactor.RuleNames()
+	}
+
+	formats := opts.Formats
+	if len(formats) == 0 {
+		formats = []OutputFormat{FormatHTML}
+	}
+	var artifacts []Artifact
+	for _, format := range formats {
+		kind := string(format)
+		switch format {
+		case FormatHTML:
+			artifacts = append(artifacts, Artifact{kind, HTMLReportFile, "HTML report", BuildHTMLReport(sizingReportData, PrerequisitesReportHTML)})
+		case FormatJSON:
+			jsonContent, err := BuildJSONReport(sizingReportData)
+			if err != nil {
+				return nil, fmt.Errorf("could not build the JSON report: %w", err)
+			}
+			artifacts = append(artifacts, Artifact{kind, JSONReportFile, "JSON report", jsonContent})
+		case FormatJUnit:
+			junitContent, err := BuildJUnitReport(sizingReportData)
+			if err != nil {
+				return nil, fmt.Errorf("could not build the JUnit report: %w", err)
+			}
+			artifacts = append(artifacts, Artifact{kind, JUnitFile, "JUnit XML report", junitContent})
+		case FormatSARIF:
+			sarifContent, err := BuildSARIFReport(sizingReportData)
+			if err != nil {
+				return nil, fmt.Errorf("could not build the SARIF report: %w", err)
+			}
+			artifacts = append(artifacts, Artifact{kind, SARIFFile, "SARIF report", sarifContent})
+		case FormatMarkdown:
+			artifacts = append(artifacts, Artifact{kind, MarkdownFile, "Markdown summary", BuildMarkdownSummary(sizingReportData)})
 		}
 	}
+	artifacts = append(artifacts, Artifact{ArtifactValues, ValuesFile, "Helm values file", BuildValuesYAML(sizingReportData)})
+	if fullDumpContent != "" {
+		artifacts = append(artifacts, Artifact{ArtifactDump, DumpFile, "Cluster dump, level " + string(opts.DumpLevel), fullDumpContent})
+	}
+	return artifacts, nil
+}
 
-	printConfigMapSuccess()
+// RunName is "<timestamp>-<cluster>", the per-run subdirectory and bundle name.
+func RunName(report *ReportData) string {
+	cluster := report.ClusterName
+	if cluster == "" {
+		cluster = "cluster"
+	}
+	return report.GeneratedAt.Format("20060102-150405") + "-" + SafeFileName(cluster)
 }
 
-func GenerateOutput(sizingReportData *ReportData, inCluster bool) {
-	htmlContent := BuildHTMLReport(sizingReportData, PrerequisitesReportHTML)
-	yamlContent := BuildValuesYAML(sizingReportData)
-	fullDumpContent := BuildFullDumpYAML(sizingReportData.FullClusterData)
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
 
-	if inCluster {
-		WriteToConfigMap(htmlContent, yamlContent, fullDumpContent)
-	} else {
-		WriteToDisk(htmlContent, yamlContent, fullDumpContent)
+// SafeFileName replaces the characters of name that are not safe in a file name, e.g. in EKS ARNs.
+func SafeFileName(name string) string {
+	return strings.Trim(unsafeFileChars.ReplaceAllString(name, "_"), "_")
+}
+
+// GenerateOutput prints the summary and writes the artifacts to a ConfigMap (in the cluster, without
+// Dir) or to disk, optionally streaming one of them to stdout. It returns the artifacts, and the
+// error of storing them, if any.
+func GenerateOutput(sizingReportData *ReportData, inCluster bool, opts OutputOptions) ([]Artifact, error) {
+	artifacts, err := BuildArtifacts(sizingReportData, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	printSummary(Console, sizingReportData, opts.Color)
+
+	if opts.Stdout != "" {
+		streamed := false
+		for _, a := range artifacts {
+			if a.Kind == opts.Stdout {
+				fmt.Fprint(os.Stdout, a.Content)
+				streamed = true
+			}
+		}
+		if !streamed {
+			log.Printf("No %s artifact to stream to stdout", opts.Stdout)
+		}
+	}
+
+	if inCluster && opts.Dir == "" {
+		if opts.Bundle {
+			log.Printf("The bundle is only written to disk; set --output-dir to get one in the cluster")
+		}
+		return artifacts, WriteToConfigMap(artifacts, opts.ConfigMap)
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	var bundle *BundleInfo
+	runName := RunName(sizingReportData)
+	if opts.RunSubdir {
+		dir = filepath.Join(dir, runName)
+	}
+	if opts.Bundle {
+		bundle = &BundleInfo{RunName: runName, Cluster: sizingReportData.ClusterName, GeneratedAt: sizingReportData.GeneratedAt}
+	}
+	if _, err := WriteToDisk(dir, artifacts, bundle); err != nil {
+		return artifacts, err
 	}
+	return artifacts, nil
 }
@@ -0,0 +1,399 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// PrerequisiteReport custom resource, see CRDManifestFile.
+const (
+	PrerequisiteReportGroup    = "prerequisites.kubescape.io"
+	PrerequisiteReportVersion  = "v1alpha1"
+	PrerequisiteReportKind     = "PrerequisiteReport"
+	PrerequisiteReportResource = "prerequisitereports"
+
+	// DefaultReportResourceName is the name of the PrerequisiteReport written for a cluster.
+	DefaultReportResourceName = "kubescape-prerequisites"
+	// ReadyCondition summarizes the check conditions: True unless a check failed or could not complete.
+	ReadyCondition = "Ready"
+
+	// CRDManifestFile is the CRD manifest generated by cmd/crdgen.
+	CRDManifestFile = "prerequisitereport-crd.yaml"
+
+	fieldManager = "kubescape-prerequisites"
+	// maxConditionMessage is the length limit of metav1.Condition.Message.
+	maxConditionMessage = 32768
+)
+
+var PrerequisiteReportGVR = schema.GroupVersionResource{
+	Group:    PrerequisiteReportGroup,
+	Version:  PrerequisiteReportVersion,
+	Resource: PrerequisiteReportResource,
+}
+
+// PrerequisiteReport is the cluster-scoped custom resource holding the latest prerequisite results.
+type PrerequisiteReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PrerequisiteReportSpec   `json:"spec"`
+	Status PrerequisiteReportStatus `json:"status,omitempty"`
+}
+
+type PrerequisiteReportSpec struct {
+	// ClusterName is the kubeconfig context the report was generated through.
+	ClusterName string `json:"clusterName,omitempty"`
+}
+
+type PrerequisiteReportStatus struct {
+	// Phase is the label of the worst check status: Passed, Warning, Failed or Error.
+	Phase string `json:"phase"`
+	// Summary is the number of passed checks, e.g. "7/9 passed".
+	Summary           string         `json:"summary"`
+	GeneratedAt       metav1.Time    `json:"generatedAt"`
+	KubernetesVersion string         `json:"kubernetesVersion"`
+	CloudProvider     string         `json:"cloudProvider"`
+	Distribution      string         `json:"distribution"`
+	NodeCount         int            `json:"nodeCount"`
+	VCPUCount         int            `json:"vcpuCount"`
+	StatusCounts      map[string]int `json:"statusCounts"`
+	// Conditions hold one condition per check, typed by the check name, plus Ready.
+	Conditions        []metav1.Condition       `json:"conditions"`
+	Sizing            PrerequisiteReportSizing `json:"sizing"`
+	RecommendedValues map[string]string        `json:"recommendedValues,omitempty"`
+}
+
+type PrerequisiteReportSizing struct {
+	TotalResources          int  `json:"totalResources"`
+	MaxNodeCPUMillicores    int  `json:"maxNodeCPUMillicores"`
+	MaxNodeMemoryMB         int  `json:"maxNodeMemoryMB"`
+	LargestContainerImageMB int  `json:"largestContainerImageMB"`
+	HasAdjustments          bool `json:"hasAdjustments"`
+	// FinalAllocations map a component (nodeAgent, storage, kubevuln) to its resources (cpuReq, cpuLim, memReq, memLim).
+	FinalAllocations map[string]map[string]string `json:"finalAllocations,omitempty"`
+}
+
+// NewPrerequisiteReportStatus converts the report data to the custom resource status.
+// Conditions keep their lastTransitionTime from previous when their status did not change.
+func NewPrerequisiteReportStatus(report *ReportData, previous []metav1.Condition) PrerequisiteReportStatus {
+	status := PrerequisiteReportStatus{
+		Phase:             WorstStatus(report.CheckResults).Label(),
+		GeneratedAt:       metav1.NewTime(report.GeneratedAt),
+		KubernetesVersion: report.KubernetesVersion,
+		CloudProvider:     report.CloudProvider,
+		Distribution:      report.K8sDistribution,
+		NodeCount:         report.TotalNodeCount,
+		VCPUCount:         report.TotalVCPUCount,
+		StatusCounts:      map[string]int{},
+		Conditions:        []metav1.Condition{},
+		Sizing: PrerequisiteReportSizing{
+			TotalResources:          report.TotalResources,
+			MaxNodeCPUMillicores:    report.MaxNodeCPUCapacity,
+			MaxNodeMemoryMB:         report.MaxNodeMemoryMB,
+			LargestContainerImageMB: report.LargestContainerImageMB,
+			HasAdjustments:          report.HasAnyAdjustments,
+			FinalAllocations:        report.FinalResourceAllocations,
+		},
+		RecommendedValues: report.RecommendedValues,
+	}
+
+	setCondition := func(c metav1.Condition) {
+		if old := meta.FindStatusCondition(previous, c.Type); old != nil {
+			status.Conditions = append(status.Conditions, *old)
+		}
+		meta.SetStatusCondition(&status.Conditions, c)
+	}
+
+	passed, counted := 0, 0
+	for _, r := range report.CheckResults {
+		status.StatusCounts[string(r.Status)]++
+		if r.Status != StatusSkip {
+			counted++
+		}
+		if r.Status == StatusPass {
+			passed++
+		}
+		setCondition(checkCondition(r))
+	}
+	status.Summary = fmt.Sprintf("%d/%d passed", passed, counted)
+
+	ready := metav1.Condition{Type: ReadyCondition, Status: metav1.ConditionTrue, Reason: "ChecksPassed", Message: status.Summary}
+	if WorstStatus(report.CheckResults).Rank() >= StatusFail.Rank() {
+		ready.Status, ready.Reason = metav1.ConditionFalse, "Checks"+status.Phase
+	}
+	setCondition(ready)
+	return status
+}
+
+// checkCondition maps a check result to a condition: passed is True, failed or warning False,
+// skipped or error Unknown.
+func checkCondition(r CheckResult) metav1.Condition {
+	c := metav1.Condition{Type: r.Name, Reason: r.Status.Label(), Message: r.Reason}
+	switch r.Status {
+	case StatusPass:
+		c.Status = metav1.ConditionTrue
+	case StatusFail, StatusWarn:
+		c.Status = metav1.ConditionFalse
+	default:
+		c.Status = metav1.ConditionUnknown
+	}
+	if r.Remediation != "" && r.Status != StatusPass && r.Status != StatusSkip {
+		c.Message = strings.TrimSpace(c.Message + " Remediation: " + r.Remediation)
+	}
+	if c.Message == "" {
+		c.Message = r.Description
+	}
+	if len(c.Message) > maxConditionMessage {
+		// Cut on a rune boundary so that the message stays valid UTF-8
+		end := maxConditionMessage
+		for end > 0 && !utf8.RuneStart(c.Message[end]) {
+			end--
+		}
+		c.Message = c.Message[:end]
+	}
+	return c
+}
+
+// ApplyPrerequisiteReport writes the report as the PrerequisiteReport name with server-side apply.
+// The conditions of the existing resource are read first to keep their transition times.
+func ApplyPrerequisiteReport(ctx context.Context, restConfig *rest.Config, name string, report *ReportData) error {
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("could not create dynamic client: %w", err)
+	}
+	if err := checkCRDInstalled(restConfig); err != nil {
+		return err
+	}
+	resource := client.Resource(PrerequisiteReportGVR)
+
+	var previousConditions []metav1.Condition
+	existing, err := resource.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return err
+	default:
+		var current PrerequisiteReport
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(existing.Object, &current); err != nil {
+			return fmt.Errorf("could not decode the existing %s: %w", name, err)
+		}
+		previousConditions = current.Status.Conditions
+	}
+
+	cr := &PrerequisiteReport{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: PrerequisiteReportGroup + "/" + PrerequisiteReportVersion,
+			Kind:       PrerequisiteReportKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"app.kubernetes.io/managed-by": fieldManager},
+		},
+		Spec: PrerequisiteReportSpec{ClusterName: report.ClusterName},
+	}
+	opts := metav1.ApplyOptions{FieldManager: fieldManager, Force: true}
+	if _, err := resource.Apply(ctx, name, toUnstructured(cr, false), opts); err != nil {
+		return err
+	}
+
+	cr.Status = NewPrerequisiteReportStatus(report, previousConditions)
+	if _, err := resource.ApplyStatus(ctx, name, toUnstructured(cr, true), opts); err != nil {
+		return fmt.Errorf("could not update the status: %w", err)
+	}
+	return nil
+}
+
+// toUnstructured converts the resource for apply; the status goes through the status
+// subresource, so the main apply leaves it out and the status apply only carries it.
+func toUnstructured(cr *PrerequisiteReport, status bool) *unstructured.Unstructured {
+	obj, _ := runtime.DefaultUnstructuredConverter.ToUnstructured(cr)
+	u := &unstructured.Unstructured{Object: obj}
+	if status {
+		unstructured.RemoveNestedField(u.Object, "spec")
+		unstructured.RemoveNestedField(u.Object, "metadata", "labels")
+	} else {
+		unstructured.RemoveNestedField(u.Object, "status")
+	}
+	unstructured.RemoveNestedField(u.Object, "metadata", "creationTimestamp")
+	return u
+}
+
+// checkCRDInstalled turns the 404 of a cluster without the CRD into an actionable error.
+func checkCRDInstalled(restConfig *rest.Config) error {
+	client, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("could not create discovery client: %w", err)
+	}
+	resources, err := client.ServerResourcesForGroupVersion(PrerequisiteReportGVR.GroupVersion().String())
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if resources != nil {
+		for _, r := range resources.APIResources {
+			if r.Name == PrerequisiteReportResource {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("the %s CRD is not installed, apply %s first", PrerequisiteReportResource, CRDManifestFile)
+}
+
+// PrerequisiteReportCRD is the CustomResourceDefinition of PrerequisiteReport.
+func PrerequisiteReportCRD() *apiextensionsv1.CustomResourceDefinition {
+	str := func(description string) apiextensionsv1.JSONSchemaProps {
+		return apiextensionsv1.JSONSchemaProps{Type: "string", Description: description}
+	}
+	integer := func(description string) apiextensionsv1.JSONSchemaProps {
+		return apiextensionsv1.JSONSchemaProps{Type: "integer", Description: description}
+	}
+	stringMap := func(description string) apiextensionsv1.JSONSchemaProps {
+		return apiextensionsv1.JSONSchemaProps{
+			Type:                 "object",
+			Description:          description,
+			AdditionalProperties: &apiextensionsv1.JSONSchemaPropsOrBool{Allows: true, Schema: &apiextensionsv1.JSONSchemaProps{Type: "string"}},
+		}
+	}
+	intMap := func(description string) apiextensionsv1.JSONSchemaProps {
+		return apiextensionsv1.JSONSchemaProps{
+			Type:                 "object",
+			Description:          description,
+			AdditionalProperties: &apiextensionsv1.JSONSchemaPropsOrBool{Allows: true, Schema: &apiextensionsv1.JSONSchemaProps{Type: "integer"}},
+		}
+	}
+	listMapKeys := "map"
+
+	condition := apiextensionsv1.JSONSchemaProps{
+		Type:     "object",
+		Required: []string{"type", "status", "reason", "message", "lastTransitionTime"},
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"type":               str("Check name, or Ready for the overall result."),
+			"status":             {Type: "string", Enum: []apiextensionsv1.JSON{{Raw: []byte(`"True"`)}, {Raw: []byte(`"False"`)}, {Raw: []byte(`"Unknown"`)}}},
+			"reason":             str("Check status: Passed, Warning, Failed, Skipped or Error."),
+			"message":            {Type: "string", MaxLength: ptrTo(int64(maxConditionMessage))},
+			"lastTransitionTime": {Type: "string", Format: "date-time"},
+			"observedGeneration": {Type: "integer", Format: "int64"},
+		},
+	}
+
+	status := apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"phase":             str("Worst check status: Passed, Warning, Failed or Error."),
+			"summary":           str("Number of passed checks, e.g. 7/9 passed; skipped checks are not counted."),
+			"generatedAt":       {Type: "string", Format: "date-time"},
+			"kubernetesVersion": str(""),
+			"cloudProvider":     str(""),
+			"distribution":      str(""),
+			"nodeCount":         integer(""),
+			"vcpuCount":         integer(""),
+			"statusCounts":      intMap("Number of checks per status."),
+			"conditions": {
+				Type:         "array",
+				Description:  "One condition per check, typed by the check name, plus Ready.",
+				Items:        &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &condition},
+				XListType:    &listMapKeys,
+				XListMapKeys: []string{"type"},
+			},
+			"sizing": {
+				Type: "object",
+				Properties: map[string]apiextensionsv1.JSONSchemaProps{
+					"totalResources":          integer(""),
+					"maxNodeCPUMillicores":    integer(""),
+					"maxNodeMemoryMB":         integer(""),
+					"largestContainerImageMB": integer(""),
+					"hasAdjustments":          {Type: "boolean", Description: "Whether the recommended resources differ from the chart defaults."},
+					"finalAllocations": {
+						Type:        "object",
+						Description: "Recommended resources per component (nodeAgent, storage, kubevuln).",
+						AdditionalProperties: &apiextensionsv1.JSONSchemaPropsOrBool{Allows: true, Schema: &apiextensionsv1.JSONSchemaProps{
+							Type:                 "object",
+							AdditionalProperties: &apiextensionsv1.JSONSchemaPropsOrBool{Allows: true, Schema: &apiextensionsv1.JSONSchemaProps{Type: "string"}},
+						}},
+					},
+				},
+			},
+			"recommendedValues": stringMap("Helm values of the kubescape-operator chart recommended by the checks."),
+		},
+	}
+
+	return &apiextensionsv1.CustomResourceDefinition{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apiextensions.k8s.io/v1", Kind: "CustomResourceDefinition"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: PrerequisiteReportResource + "." + PrerequisiteReportGroup,
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: PrerequisiteReportGroup,
+			Scope: apiextensionsv1.ClusterScoped,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Plural:     PrerequisiteReportResource,
+				Singular:   strings.ToLower(PrerequisiteReportKind),
+				Kind:       PrerequisiteReportKind,
+				ListKind:   PrerequisiteReportKind + "List",
+				ShortNames: []string{"prereq"},
+			},
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+				Name:    PrerequisiteReportVersion,
+				Served:  true,
+				Storage: true,
+				Schema: &apiextensionsv1.CustomResourceValidation{OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+					Type:        "object",
+					Description: "Result of the Kubescape prerequisite checks and sizing for this cluster.",
+					Properties: map[string]apiextensionsv1.JSONSchemaProps{
+						"apiVersion": {Type: "string"},
+						"kind":       {Type: "string"},
+						"metadata":   {Type: "object"},
+						"spec": {
+							Type: "object",
+							Properties: map[string]apiextensionsv1.JSONSchemaProps{
+								"clusterName": str("Kubeconfig context the report was generated through."),
+							},
+						},
+						"status": status,
+					},
+				}},
+				Subresources: &apiextensionsv1.CustomResourceSubresources{Status: &apiextensionsv1.CustomResourceSubresourceStatus{}},
+				AdditionalPrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{
+					{Name: "Phase", Type: "string", JSONPath: ".status.phase"},
+					{Name: "Checks", Type: "string", JSONPath: ".status.summary"},
+					{Name: "Version", Type: "string", JSONPath: ".status.kubernetesVersion"},
+					{Name: "Nodes", Type: "integer", JSONPath: ".status.nodeCount"},
+					{Name: "Generated", Type: "date", JSONPath: ".status.generatedAt"},
+				},
+			}},
+		},
+	}
+}
+
+// BuildCRDManifest renders the CRD as YAML.
+func BuildCRDManifest() (string, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(PrerequisiteReportCRD())
+	if err != nil {
+		return "", err
+	}
+	// Drop the empty fields the API server fills in
+	unstructured.RemoveNestedField(obj, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(obj, "status")
+	b, err := sigsyaml.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func ptrTo[T any](v T) *T {
+	return &v
+}
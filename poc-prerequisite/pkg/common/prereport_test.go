@@ -0,0 +1,85 @@
+package common
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewPrerequisiteReportStatus(t *testing.T) {
+	earlier := metav1.NewTime(time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC))
+	previous := []metav1.Condition{
+		{Type: "pv-provisioning", Status: metav1.ConditionTrue, Reason: "Passed", LastTransitionTime: earlier},
+		{Type: "network-egress", Status: metav1.ConditionTrue, Reason: "Passed", LastTransitionTime: earlier},
+	}
+
+	tests := []struct {
+		name        string
+		results     []CheckResult
+		wantPhase   string
+		wantSummary string
+		wantReady   metav1.ConditionStatus
+	}{
+		{
+			name:        "all passed",
+			results:     []CheckResult{{Name: "pv-provisioning", Status: StatusPass}, {Name: "network-egress", Status: StatusPass}},
+			wantPhase:   "Passed",
+			wantSummary: "2/2 passed",
+			wantReady:   metav1.ConditionTrue,
+		},
+		{
+			name:        "warning stays ready",
+			results:     []CheckResult{{Name: "pv-provisioning", Status: StatusPass}, {Name: "network-egress", Status: StatusWarn}},
+			wantPhase:   "Warning",
+			wantSummary: "1/2 passed",
+			wantReady:   metav1.ConditionTrue,
+		},
+		{
+			name:        "failure is not ready, skipped not counted",
+			results:     []CheckResult{{Name: "pv-provisioning", Status: StatusFail}, {Name: "ebpf-support", Status: StatusSkip}},
+			wantPhase:   "Failed",
+			wantSummary: "0/1 passed",
+			wantReady:   metav1.ConditionFalse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := NewPrerequisiteReportStatus(&ReportData{CheckResults: tt.results}, previous)
+			if status.Phase != tt.wantPhase || status.Summary != tt.wantSummary {
+				t.Errorf("phase %q summary %q, want %q %q", status.Phase, status.Summary, tt.wantPhase, tt.wantSummary)
+			}
+			ready := meta.FindStatusCondition(status.Conditions, ReadyCondition)
+			if ready == nil || ready.Status != tt.wantReady {
+				t.Errorf("Ready = %+v, want %s", ready, tt.wantReady)
+			}
+			for _, r := range tt.results {
+				c := meta.FindStatusCondition(status.Conditions, r.Name)
+				if c == nil {
+					t.Fatalf("no condition for %s", r.Name)
+				}
+				old := meta.FindStatusCondition(previous, r.Name)
+				unchanged := old != nil && old.Status == c.Status
+				if unchanged != c.LastTransitionTime.Equal(&earlier) {
+					t.Errorf("%s: lastTransitionTime %v, unchanged status %v", r.Name, c.LastTransitionTime, unchanged)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckConditionTruncatesOnRuneBoundary(t *testing.T) {
+	// 3-byte runes, so that the byte limit falls inside a rune
+	reason := strings.Repeat("€", maxConditionMessage/3+10)
+
+	c := checkCondition(CheckResult{Name: "network-egress", Status: StatusPass, Reason: reason})
+	if len(c.Message) > maxConditionMessage {
+		t.Errorf("message has %d bytes, limit %d", len(c.Message), maxConditionMessage)
+	}
+	if !utf8.ValidString(c.Message) {
+		t.Error("message is not valid UTF-8")
+	}
+}
@@ -0,0 +1,485 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// DumpLevel selects how much of the cluster data goes into full-cluster-dump.yaml.
+type DumpLevel string
+
+const (
+	// DumpLevelNone writes no dump.
+	DumpLevelNone DumpLevel = "none"
+	// DumpLevelSummary writes counts, cluster details and anonymized node capacities only.
+	DumpLevelSummary DumpLevel = "summary"
+	// DumpLevelRedacted writes every object with the redaction rules applied.
+	DumpLevelRedacted DumpLevel = "redacted"
+	// DumpLevelFull writes every object as collected.
+	DumpLevelFull DumpLevel = "full"
+)
+
+func ParseDumpLevel(value string) (DumpLevel, error) {
+	switch l := DumpLevel(value); l {
+	case DumpLevelNone, DumpLevelSummary, DumpLevelRedacted, DumpLevelFull:
+		return l, nil
+	default:
+		return "", fmt.Errorf("invalid --dump-level value %q (expected none, summary, redacted or full)", value)
+	}
+}
+
+// NeedsFullObjects reports whether the level dumps complete workload objects,
+// which then have to be collected instead of only counted.
+func (l DumpLevel) NeedsFullObjects() bool {
+	return l == DumpLevelRedacted || l == DumpLevelFull
+}
+
+const redactedValue = "REDACTED"
+
+// RedactionRule replaces matching values in the dumped objects.
+//
+// Path is a dot-separated field path in the Kubernetes JSON field names, where "*" matches
+// any map key or list item, "**" any number of levels, and "[key]" a key containing dots,
+// e.g. "metadata.labels[kubernetes.io/hostname]". Pattern is a regular expression replaced
+// in every string value. A rule has either a Path or a Pattern.
+type RedactionRule struct {
+	Name string `json:"name"`
+	// Kinds limits the rule to some ClusterData kinds, e.g. ["pods", "deployments"]. Default: all.
+	Kinds   []string `json:"kinds,omitempty"`
+	Path    string   `json:"path,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+	// Hash replaces values with a pseudonym instead of a constant, so that references
+	// between objects (e.g. node names) stay consistent within one dump. Pseudonyms are
+	// keyed with a random per-dump secret and cannot be brute-forced back to the value.
+	Hash bool `json:"hash,omitempty"`
+}
+
+// BuiltinRedactionRules cover environment values, command lines, annotations
+// (including last-applied-configuration), IP addresses, hostnames and the machine and
+// cloud instance IDs of nodes.
+var BuiltinRedactionRules = []RedactionRule{
+	{Name: "env", Path: "**.containers.*.env.*.value"},
+	{Name: "env", Path: "**.initContainers.*.env.*.value"},
+	{Name: "env", Path: "**.ephemeralContainers.*.env.*.value"},
+	{Name: "args", Path: "**.containers.*.command"},
+	{Name: "args", Path: "**.containers.*.args"},
+	{Name: "args", Path: "**.initContainers.*.command"},
+	{Name: "args", Path: "**.initContainers.*.args"},
+	{Name: "args", Path: "**.ephemeralContainers.*.command"},
+	{Name: "args", Path: "**.ephemeralContainers.*.args"},
+	{Name: "args", Path: "**.exec.command"},
+	{Name: "annotations", Path: "**.annotations.*"},
+	{Name: "ips", Path: "status.podIP", Hash: true},
+	{Name: "ips", Path: "status.podIPs.*.ip", Hash: true},
+	{Name: "ips", Path: "status.hostIP", Hash: true},
+	{Name: "ips", Path: "status.hostIPs.*.ip", Hash: true},
+	{Name: "ips", Path: "spec.clusterIP", Hash: true},
+	{Name: "ips", Path: "spec.clusterIPs.*", Hash: true},
+	{Name: "ips", Path: "spec.externalIPs.*", Hash: true},
+	{Name: "ips", Path: "spec.loadBalancerIP", Hash: true},
+	{Name: "ips", Path: "status.loadBalancer.ingress.*.ip", Hash: true},
+	{Name: "ips", Kinds: []string{"nodes"}, Path: "spec.podCIDR", Hash: true},
+	{Name: "ips", Kinds: []string{"nodes"}, Path: "spec.podCIDRs.*", Hash: true},
+	{Name: "ips", Kinds: []string{"nodes"}, Path: "status.addresses.*.address", Hash: true},
+	{Name: "hostnames", Kinds: []string{"nodes"}, Path: "metadata.name", Hash: true},
+	{Name: "hostnames", Path: "metadata.labels[kubernetes.io/hostname]", Hash: true},
+	{Name: "hostnames", Path: "**.nodeSelector[kubernetes.io/hostname]", Hash: true},
+	{Name: "hostnames", Path: "**.spec.nodeName", Hash: true},
+	{Name: "hostnames", Path: "**.spec.hostname", Hash: true},
+	{Name: "hostnames", Path: "spec.externalName", Hash: true},
+	{Name: "hostnames", Path: "status.loadBalancer.ingress.*.hostname", Hash: true},
+	{Name: "node-ids", Kinds: []string{"nodes"}, Path: "spec.providerID", Hash: true},
+	{Name: "node-ids", Kinds: []string{"nodes"}, Path: "status.nodeInfo.machineID", Hash: true},
+	{Name: "node-ids", Kinds: []string{"nodes"}, Path: "status.nodeInfo.systemUUID", Hash: true},
+	{Name: "node-ids", Kinds: []string{"nodes"}, Path: "status.nodeInfo.bootID", Hash: true},
+}
+
+// urlHostPattern and messagePatterns find the URL hosts, ARNs, IP addresses and hostnames
+// in free-text collection errors, e.g. `Get "https://<api server>/api/v1/pods": dial tcp
+// 10.0.0.1:443: i/o timeout`. Hostnames need two dots, so that resources such as
+// "deployments.apps" stay readable.
+var (
+	urlHostPattern  = regexp.MustCompile(`://[^/\s"'<>]+`)
+	messagePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`arn:[a-z0-9-]+:[^\s"']+`),
+		regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`),
+		regexp.MustCompile(`\[[0-9a-fA-F]*:[0-9a-fA-F:.]*\]`),
+		regexp.MustCompile(`\b(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?\.){2,}[a-zA-Z][a-zA-Z0-9-]*\b`),
+	}
+)
+
+// LoadRedactionRules reads user rules from a YAML or JSON file of the form
+// "rules: [{name, kinds, path, pattern, hash}]".
+func LoadRedactionRules(path string) ([]RedactionRule, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Rules []RedactionRule `json:"rules"`
+	}
+	if err := sigsyaml.UnmarshalStrict(content, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file.Rules, nil
+}
+
+type compiledRule struct {
+	RedactionRule
+	segments []string
+	pattern  *regexp.Regexp
+	kinds    map[string]bool
+}
+
+// Redactor applies the built-in and user redaction rules to a copy of ClusterData.
+type Redactor struct {
+	rules []compiledRule
+}
+
+func NewRedactor(userRules []RedactionRule) (*Redactor, error) {
+	r := &Redactor{}
+	for i, rule := range append(append([]RedactionRule{}, BuiltinRedactionRules...), userRules...) {
+		if rule.Name == "" {
+			rule.Name = "custom-" + strconv.Itoa(i-len(BuiltinRedactionRules)+1)
+		}
+		c := compiledRule{RedactionRule: rule}
+		switch {
+		case rule.Path != "" && rule.Pattern != "":
+			return nil, fmt.Errorf("redaction rule %q: path and pattern are mutually exclusive", rule.Name)
+		case rule.Path != "":
+			segments, err := parseRedactionPath(rule.Path)
+			if err != nil {
+				return nil, fmt.Errorf("redaction rule %q: %w", rule.Name, err)
+			}
+			c.segments = segments
+		case rule.Pattern != "":
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("redaction rule %q: %w", rule.Name, err)
+			}
+			c.pattern = re
+		default:
+			return nil, fmt.Errorf("redaction rule %q needs a path or a pattern", rule.Name)
+		}
+		if len(rule.Kinds) > 0 {
+			c.kinds = map[string]bool{}
+			for _, kind := range rule.Kinds {
+				c.kinds[strings.ToLower(kind)] = true
+			}
+		}
+		r.rules = append(r.rules, c)
+	}
+	return r, nil
+}
+
+// RuleNames returns the distinct rule names in order, for the report.
+func (r *Redactor) RuleNames() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, rule := range r.rules {
+		if !seen[rule.Name] {
+			seen[rule.Name] = true
+			names = append(names, rule.Name)
+		}
+	}
+	return names
+}
+
+// Redact returns a copy of cd with the rules applied to every object; cd is left untouched.
+// Every call draws a new pseudonym key, so pseudonyms only correlate within one dump.
+func (r *Redactor) Redact(cd *ClusterData) (*ClusterData, error) {
+	m, err := newMasker()
+	if err != nil {
+		return nil, err
+	}
+	out := *cd
+	// Context names often embed account IDs, e.g. EKS ARNs
+	out.ClusterDetails.Name = m.mask(cd.ClusterDetails.Name, true)
+	if out.Nodes, err = redactKind(r, m, "nodes", cd.Nodes); err != nil {
+		return nil, err
+	}
+	if out.Pods, err = redactKind(r, m, "pods", cd.Pods); err != nil {
+		return nil, err
+	}
+	if out.Services, err = redactKind(r, m, "services", cd.Services); err != nil {
+		return nil, err
+	}
+	if out.Deployments, err = redactKind(r, m, "deployments", cd.Deployments); err != nil {
+		return nil, err
+	}
+	if out.ReplicaSets, err = redactKind(r, m, "replicasets", cd.ReplicaSets); err != nil {
+		return nil, err
+	}
+	if out.StatefulSets, err = redactKind(r, m, "statefulsets", cd.StatefulSets); err != nil {
+		return nil, err
+	}
+	if out.DaemonSets, err = redactKind(r, m, "daemonsets", cd.DaemonSets); err != nil {
+		return nil, err
+	}
+	if out.Jobs, err = redactKind(r, m, "jobs", cd.Jobs); err != nil {
+		return nil, err
+	}
+	if out.CronJobs, err = redactKind(r, m, "cronjobs", cd.CronJobs); err != nil {
+		return nil, err
+	}
+
+	// Collection errors quote API server URLs, node names and user ARNs
+	if cd.CollectionErrors != nil {
+		out.CollectionErrors = make(map[string]string, len(cd.CollectionErrors))
+		for kind, msg := range cd.CollectionErrors {
+			out.CollectionErrors[kind] = r.redactMessage(m, msg)
+		}
+	}
+	if cd.CollectionStats != nil {
+		out.CollectionStats = make([]CollectionStat, len(cd.CollectionStats))
+		for i, stat := range cd.CollectionStats {
+			stat.Error = r.redactMessage(m, stat.Error)
+			out.CollectionStats[i] = stat
+		}
+	}
+	return &out, nil
+}
+
+// redactMessage pseudonymizes the URLs, ARNs, addresses and hostnames in a message,
+// then applies the pattern rules that are not limited to some kinds.
+func (r *Redactor) redactMessage(m *masker, msg string) string {
+	msg = urlHostPattern.ReplaceAllStringFunc(msg, func(match string) string { return "://" + m.mask(match[len("://"):], true) })
+	for _, re := range messagePatterns {
+		msg = re.ReplaceAllStringFunc(msg, func(match string) string { return m.mask(match, true) })
+	}
+	for _, rule := range r.rules {
+		if rule.pattern != nil && rule.kinds == nil {
+			msg = rule.pattern.ReplaceAllStringFunc(msg, func(match string) string { return m.mask(match, rule.Hash) })
+		}
+	}
+	return msg
+}
+
+// redactKind round-trips the objects through their JSON form, applies the rules and decodes them back.
+func redactKind[T any](r *Redactor, m *masker, kind string, items []T) ([]T, error) {
+	if len(items) == 0 {
+		return items, nil
+	}
+	raw, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var objects []any
+	if err := json.Unmarshal(raw, &objects); err != nil {
+		return nil, err
+	}
+	for i := range objects {
+		for _, rule := range r.rules {
+			if rule.kinds != nil && !rule.kinds[kind] {
+				continue
+			}
+			if rule.pattern != nil {
+				objects[i] = replaceStrings(objects[i], func(s string) string {
+					return rule.pattern.ReplaceAllStringFunc(s, func(match string) string { return m.mask(match, rule.Hash) })
+				})
+			} else {
+				objects[i] = m.redactPath(objects[i], rule.segments, rule.Hash)
+			}
+		}
+	}
+	if raw, err = json.Marshal(objects); err != nil {
+		return nil, err
+	}
+	var redacted []T
+	if err := json.Unmarshal(raw, &redacted); err != nil {
+		return nil, fmt.Errorf("redacting %s: %w", kind, err)
+	}
+	return redacted, nil
+}
+
+// parseRedactionPath splits "a.*.b[c.d]" into ["a", "*", "b", "c.d"].
+func parseRedactionPath(path string) ([]string, error) {
+	var segments []string
+	for path != "" {
+		switch {
+		case path[0] == '.':
+			path = path[1:]
+		case path[0] == '[':
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [ in path")
+			}
+			segments = append(segments, path[1:end])
+			path = path[end+1:]
+		default:
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			segments = append(segments, path[:end])
+			path = path[end:]
+		}
+	}
+	if len(segments) == 0 || segments[len(segments)-1] == "**" {
+		return nil, fmt.Errorf("path must end with a field")
+	}
+	return segments, nil
+}
+
+// redactPath masks the values matched by segments in a decoded JSON value.
+func (m *masker) redactPath(node any, segments []string, hash bool) any {
+	if len(segments) == 0 {
+		return replaceStrings(node, func(s string) string { return m.mask(s, hash) })
+	}
+	seg, rest := segments[0], segments[1:]
+
+	switch v := node.(type) {
+	case map[string]any:
+		for key, child := range v {
+			switch {
+			case seg == "**":
+				child = m.redactPath(child, segments, hash)
+				if key == rest[0] || rest[0] == "*" {
+					child = m.redactPath(child, rest[1:], hash)
+				}
+			case seg == "*" || seg == key:
+				child = m.redactPath(child, rest, hash)
+			}
+			v[key] = child
+		}
+	case []any:
+		for i, child := range v {
+			switch {
+			case seg == "**":
+				child = m.redactPath(child, segments, hash)
+				if rest[0] == "*" || rest[0] == strconv.Itoa(i) {
+					child = m.redactPath(child, rest[1:], hash)
+				}
+				v[i] = child
+			case seg == "*" || seg == strconv.Itoa(i):
+				v[i] = m.redactPath(child, rest, hash)
+			}
+		}
+	}
+	return node
+}
+
+// replaceStrings applies replace to every string in a decoded JSON value.
+func replaceStrings(node any, replace func(string) string) any {
+	switch v := node.(type) {
+	case string:
+		return replace(v)
+	case map[string]any:
+		for key, child := range v {
+			v[key] = replaceStrings(child, replace)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = replaceStrings(child, replace)
+		}
+	}
+	return node
+}
+
+// masker replaces values with REDACTED or with a pseudonym keyed by a random secret,
+// so that small value sets such as node IPs cannot be recovered by hashing candidates.
+type masker struct {
+	key []byte
+}
+
+func newMasker() (*masker, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generating the redaction key: %w", err)
+	}
+	return &masker{key: key}, nil
+}
+
+// mask returns the replacement of value; already redacted values are kept,
+// so overlapping rules do not hash a pseudonym again.
+func (m *masker) mask(value string, hash bool) string {
+	if value == "" || value == redactedValue || strings.HasPrefix(value, redactedValue+"-") {
+		return value
+	}
+	if !hash {
+		return redactedValue
+	}
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte(value))
+	return redactedValue + "-" + hex.EncodeToString(mac.Sum(nil)[:6])
+}
+
+// SummarizeClusterData keeps what sizing and the passive checks need: cluster details, counts,
+// and nodes reduced to capacity, system info, labels and image sizes under generated names.
+func SummarizeClusterData(cd *ClusterData) *ClusterData {
+	out := &ClusterData{
+		ClusterDetails:     cd.ClusterDetails,
+		NodeInfoSummaries:  cd.NodeInfoSummaries,
+		MetadataOnly:       true,
+		ResourceCounts:     cd.ResourceCounts,
+		CollectionStats:    cd.CollectionStats,
+		CollectionDuration: cd.CollectionDuration,
+		CollectionErrors:   cd.CollectionErrors,
+	}
+	// Context names often embed account IDs, e.g. EKS ARNs
+	out.ClusterDetails.Name = ""
+	for i, node := range cd.Nodes {
+		labels := make(map[string]string, len(node.Labels))
+		for k, v := range node.Labels {
+			if k != corev1.LabelHostname {
+				labels[k] = v
+			}
+		}
+		images := make([]corev1.ContainerImage, 0, len(node.Status.Images))
+		for _, image := range node.Status.Images {
+			images = append(images, corev1.ContainerImage{SizeBytes: image.SizeBytes})
+		}
+		nodeInfo := node.Status.NodeInfo
+		nodeInfo.MachineID, nodeInfo.SystemUUID, nodeInfo.BootID = "", "", ""
+
+		out.Nodes = append(out.Nodes, corev1.Node{
+			TypeMeta:   node.TypeMeta,
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node-%d", i+1), Labels: labels},
+			Status: corev1.NodeStatus{
+				Capacity:    node.Status.Capacity,
+				Allocatable: node.Status.Allocatable,
+				NodeInfo:    nodeInfo,
+				Images:      images,
+			},
+		})
+	}
+	return out
+}
+
+// BuildDumpYAML returns the content of full-cluster-dump.yaml for the level, or "" for DumpLevelNone.
+func BuildDumpYAML(cd *ClusterData, level DumpLevel, redactor *Redactor) (string, error) {
+	switch level {
+	case DumpLevelSummary:
+		summary := SummarizeClusterData(cd)
+		summary.DumpLevel = level
+		return BuildFullDumpYAML(summary), nil
+	case DumpLevelRedacted:
+		if redactor == nil {
+			return "", fmt.Errorf("the redacted dump level needs a redactor")
+		}
+		redacted, err := redactor.Redact(cd)
+		if err != nil {
+			return "", err
+		}
+		redacted.DumpLevel = level
+		return BuildFullDumpYAML(redacted), nil
+	case DumpLevelFull:
+		full := *cd
+		full.DumpLevel = level
+		return BuildFullDumpYAML(&full), nil
+	default:
+		return "", nil
+	}
+}
@@ -0,0 +1,132 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func redactTestData() *ClusterData {
+	return &ClusterData{
+		ClusterDetails: ClusterDetails{Name: "arn:aws:eks:eu-west-1:123456789012:cluster/prod"},
+		Nodes: []corev1.Node{{
+			ObjectMeta: metav1.ObjectMeta{Name: "ip-10-0-1-12.eu-west-1.compute.internal"},
+			Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: "10.0.1.12"},
+			}},
+		}},
+		Pods: []corev1.Pod{{
+			ObjectMeta: metav1.ObjectMeta{Name: "web"},
+			Spec:       corev1.PodSpec{NodeName: "ip-10-0-1-12.eu-west-1.compute.internal"},
+			Status:     corev1.PodStatus{HostIP: "10.0.1.12"},
+		}},
+	}
+}
+
+func TestRedactPseudonyms(t *testing.T) {
+	redactor, err := NewRedactor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd := redactTestData()
+
+	out, err := redactor.Redact(cd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeName := out.Nodes[0].Name
+	if !strings.HasPrefix(nodeName, redactedValue+"-") {
+		t.Fatalf("node name %q not pseudonymized", nodeName)
+	}
+	if out.Pods[0].Spec.NodeName != nodeName {
+		t.Errorf("pod nodeName %q does not match node pseudonym %q", out.Pods[0].Spec.NodeName, nodeName)
+	}
+	if out.Pods[0].Status.HostIP != out.Nodes[0].Status.Addresses[0].Address {
+		t.Errorf("host IP pseudonyms differ within one dump")
+	}
+
+	sum := sha256.Sum256([]byte("10.0.1.12"))
+	if unsalted := hex.EncodeToString(sum[:]); strings.Contains(unsalted, strings.TrimPrefix(out.Pods[0].Status.HostIP, redactedValue+"-")) {
+		t.Errorf("pseudonym %q is derived from an unkeyed hash", out.Pods[0].Status.HostIP)
+	}
+
+	again, err := redactor.Redact(cd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Nodes[0].Name == nodeName {
+		t.Errorf("pseudonym %q repeated across dumps", nodeName)
+	}
+	if cd.Nodes[0].Name != "ip-10-0-1-12.eu-west-1.compute.internal" {
+		t.Errorf("input was modified")
+	}
+}
+
+func TestRedactClusterName(t *testing.T) {
+	redactor, err := NewRedactor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := redactor.Redact(redactTestData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := out.ClusterDetails.Name; strings.Contains(name, "123456789012") || !strings.HasPrefix(name, redactedValue+"-") {
+		t.Errorf("cluster name %q not redacted", name)
+	}
+}
+
+func TestRedactedDumpHidesIdentifiers(t *testing.T) {
+	redactor, err := NewRedactor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd := redactTestData()
+	cd.Nodes[0].Spec.ProviderID = "aws:///eu-west-1a/i-0abc123def4567890"
+	cd.Nodes[0].Status.NodeInfo = corev1.NodeSystemInfo{
+		MachineID:  "ec2f6c2a9b8e4d1f8a7b6c5d4e3f2a1b",
+		SystemUUID: "EC2F6C2A-9B8E-4D1F-8A7B-6C5D4E3F2A1B",
+		BootID:     "0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0",
+	}
+	cd.CollectionErrors = map[string]string{
+		"pods": `Get "https://0123456789ABCDEF.gr7.eu-west-1.eks.amazonaws.com/api/v1/pods?limit=500": dial tcp 10.0.1.12:443: i/o timeout`,
+		"jobs": `jobs.batch is forbidden: User "arn:aws:sts::123456789012:assumed-role/poc/checker" cannot list resource "jobs"`,
+	}
+	cd.CollectionStats = []CollectionStat{
+		{Kind: "nodes", Count: 1},
+		{Kind: "pods", Error: `Get "https://[fd00::1]:6443/api/v1/pods": lookup ip-10-0-1-12.eu-west-1.compute.internal: no such host`},
+	}
+
+	dump, err := BuildDumpYAML(cd, DumpLevelRedacted, redactor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{
+		"i-0abc123def4567890",
+		"ec2f6c2a9b8e4d1f8a7b6c5d4e3f2a1b",
+		"EC2F6C2A-9B8E-4D1F-8A7B-6C5D4E3F2A1B",
+		"0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0",
+		"0123456789ABCDEF",
+		"amazonaws.com",
+		"10.0.1.12",
+		"fd00::1",
+		"123456789012",
+		"ip-10-0-1-12",
+	} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("redacted dump contains %q", secret)
+		}
+	}
+	for _, kept := range []string{"/api/v1/pods", "i/o timeout", "jobs.batch is forbidden", "no such host"} {
+		if !strings.Contains(dump, kept) {
+			t.Errorf("redacted dump lost %q from the collection errors", kept)
+		}
+	}
+	if !strings.Contains(cd.CollectionStats[1].Error, "fd00::1") || !strings.Contains(cd.CollectionErrors["pods"], "10.0.1.12") {
+		t.Errorf("input was modified")
+	}
+}
@@ -0,0 +1,226 @@
+package common
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ReportSchemaVersion is the version of the JSON report schema, see
+// schema/prerequisites-report.v1.schema.json. Fields may be added within a version;
+// renaming or removing a field, or changing its meaning, requires a new version.
+const ReportSchemaVersion = "v1"
+
+// ReportKind identifies the JSON report document.
+const ReportKind = "KubescapePrerequisitesReport"
+
+// JSONReport is the machine-readable report written by --output-format json.
+// It is decoupled from ReportData so that internal changes do not break consumers.
+type JSONReport struct {
+	SchemaVersion string `json:"schemaVersion"`
+	Kind          string `json:"kind"`
+	GeneratedAt   string `json:"generatedAt"`
+	// DataSource is "live", or the dump file the report was regenerated from.
+	DataSource string `json:"dataSource"`
+
+	Cluster           JSONCluster       `json:"cluster"`
+	Nodes             JSONNodes         `json:"nodes"`
+	Sizing            JSONSizing        `json:"sizing"`
+	Checks            []JSONCheck       `json:"checks"`
+	StatusCounts      map[string]int    `json:"statusCounts"`
+	RecommendedValues map[string]string `json:"recommendedValues"`
+	Collection        JSONCollection    `json:"collection"`
+}
+
+type JSONCluster struct {
+	Name              string `json:"name,omitempty"`
+	KubernetesVersion string `json:"kubernetesVersion"`
+	CloudProvider     string `json:"cloudProvider"`
+	Distribution      string `json:"distribution"`
+	NodeCount         int    `json:"nodeCount"`
+	VCPUCount         int    `json:"vcpuCount"`
+}
+
+// JSONNodes counts the nodes per value of each node property.
+type JSONNodes struct {
+	OperatingSystems  map[string]int `json:"operatingSystems"`
+	Architectures     map[string]int `json:"architectures"`
+	KernelVersions    map[string]int `json:"kernelVersions"`
+	OSImages          map[string]int `json:"osImages"`
+	ContainerRuntimes map[string]int `json:"containerRuntimes"`
+	KubeletVersions   map[string]int `json:"kubeletVersions"`
+	KubeProxyVersions map[string]int `json:"kubeProxyVersions"`
+}
+
+type JSONSizing struct {
+	Inputs JSONSizingInputs `json:"inputs"`
+	// Allocations map a component (nodeAgent, storage, kubevuln) to its resources (cpuReq, cpuLim, memReq, memLim).
+	DefaultAllocations map[string]map[string]string `json:"defaultAllocations"`
+	FinalAllocations   map[string]map[string]string `json:"finalAllocations"`
+	HasAdjustments     bool                         `json:"hasAdjustments"`
+	AccuracyNotes      []string                     `json:"accuracyNotes"`
+}
+
+type JSONSizingInputs struct {
+	TotalResources          int `json:"totalResources"`
+	MaxNodeCPUMillicores    int `json:"maxNodeCPUMillicores"`
+	MaxNodeMemoryMB         int `json:"maxNodeMemoryMB"`
+	LargestContainerImageMB int `json:"largestContainerImageMB"`
+}
+
+type JSONCheck struct {
+	Name              string            `json:"name"`
+	Description       string            `json:"description"`
+	Type              CheckType         `json:"type"`
+	Status            CheckStatus       `json:"status"`
+	Severity          Severity          `json:"severity"`
+	Reason            string            `json:"reason,omitempty"`
+	Evidence          []JSONObjectRef   `json:"evidence,omitempty"`
+	Remediation       string            `json:"remediation,omitempty"`
+	Details           *JSONTable        `json:"details,omitempty"`
+	RecommendedValues map[string]string `json:"recommendedValues,omitempty"`
+}
+
+type JSONObjectRef struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+type JSONTable struct {
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+type JSONCollection struct {
+	DurationMs     int64                `json:"durationMs"`
+	MissingData    []JSONMissingData    `json:"missingData"`
+	Stats          []JSONCollectionStat `json:"stats"`
+	DumpLevel      DumpLevel            `json:"dumpLevel"`
+	RedactionRules []string             `json:"redactionRules,omitempty"`
+}
+
+type JSONMissingData struct {
+	Kind  string `json:"kind"`
+	Error string `json:"error"`
+}
+
+type JSONCollectionStat struct {
+	Kind       string `json:"kind"`
+	Count      int    `json:"count"`
+	Pages      int    `json:"pages"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// NewJSONReport converts the report data to the JSON report schema.
+func NewJSONReport(report *ReportData) *JSONReport {
+	out := &JSONReport{
+		SchemaVersion: ReportSchemaVersion,
+		Kind:          ReportKind,
+		GeneratedAt:   report.GeneratedAt.UTC().Format(time.RFC3339),
+		DataSource:    "live",
+		Cluster: JSONCluster{
+			KubernetesVersion: report.KubernetesVersion,
+			CloudProvider:     report.CloudProvider,
+			Distribution:      report.K8sDistribution,
+			NodeCount:         report.TotalNodeCount,
+			VCPUCount:         report.TotalVCPUCount,
+		},
+		Sizing: JSONSizing{
+			Inputs: JSONSizingInputs{
+				TotalResources:          report.TotalResources,
+				MaxNodeCPUMillicores:    report.MaxNodeCPUCapacity,
+				MaxNodeMemoryMB:         report.MaxNodeMemoryMB,
+				LargestContainerImageMB: report.LargestContainerImageMB,
+			},
+			DefaultAllocations: report.DefaultResourceAllocations,
+			FinalAllocations:   report.FinalResourceAllocations,
+			HasAdjustments:     report.HasAnyAdjustments,
+			AccuracyNotes:      nonNil(report.SizingAccuracyNotes),
+		},
+		Checks:            []JSONCheck{},
+		StatusCounts:      map[string]int{},
+		RecommendedValues: map[string]string{},
+		Collection: JSONCollection{
+			MissingData:    []JSONMissingData{},
+			Stats:          []JSONCollectionStat{},
+			DumpLevel:      report.DumpLevel,
+			RedactionRules: report.RedactionRules,
+		},
+	}
+	if report.DataSource != "" {
+		out.DataSource = report.DataSource
+	}
+	if out.Collection.DumpLevel == "" {
+		out.Collection.DumpLevel = DumpLevelNone
+	}
+
+	if cd := report.FullClusterData; cd != nil {
+		out.Cluster.Name = cd.ClusterDetails.Name
+		ni := cd.NodeInfoSummaries
+		out.Nodes = JSONNodes{
+			OperatingSystems:  ni.OperatingSystemCounts,
+			Architectures:     ni.ArchitectureCounts,
+			KernelVersions:    ni.KernelVersionCounts,
+			OSImages:          ni.OSImageCounts,
+			ContainerRuntimes: ni.ContainerRuntimeVersionCounts,
+			KubeletVersions:   ni.KubeletVersionCounts,
+			KubeProxyVersions: ni.KubeProxyVersionCounts,
+		}
+		out.Collection.DurationMs = cd.CollectionDuration.Milliseconds()
+	}
+
+	for _, r := range report.CheckResults {
+		check := JSONCheck{
+			Name:              r.Name,
+			Description:       r.Description,
+			Type:              r.Type,
+			Status:            r.Status,
+			Severity:          r.Severity,
+			Reason:            r.Reason,
+			Remediation:       r.Remediation,
+			RecommendedValues: r.RecommendedValues,
+		}
+		for _, e := range r.Evidence {
+			check.Evidence = append(check.Evidence, JSONObjectRef(e))
+		}
+		if r.Details != nil {
+			check.Details = &JSONTable{Columns: r.Details.Columns, Rows: r.Details.Rows}
+		}
+		out.Checks = append(out.Checks, check)
+		out.StatusCounts[string(r.Status)]++
+	}
+	for key, val := range report.RecommendedValues {
+		out.RecommendedValues[key] = val
+	}
+	for _, m := range report.MissingData {
+		out.Collection.MissingData = append(out.Collection.MissingData, JSONMissingData(m))
+	}
+	for _, st := range report.CollectionStats {
+		out.Collection.Stats = append(out.Collection.Stats, JSONCollectionStat{
+			Kind:       st.Kind,
+			Count:      st.Count,
+			Pages:      st.Pages,
+			DurationMs: st.Duration.Milliseconds(),
+			Error:      st.Error,
+		})
+	}
+	return out
+}
+
+// BuildJSONReport renders the report as indented JSON.
+func BuildJSONReport(report *ReportData) (string, error) {
+	b, err := json.MarshalIndent(NewJSONReport(report), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+func nonNil(items []string) []string {
+	if items == nil {
+		return []string{}
+	}
+	return items
+}
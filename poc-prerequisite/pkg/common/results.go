@@ -0,0 +1,109 @@
+package common
+
+// CheckStatus is the outcome of a single prerequisite check.
+type CheckStatus string
+
+const (
+	StatusPass  CheckStatus = "pass"
+	StatusWarn  CheckStatus = "warn"
+	StatusFail  CheckStatus = "fail"
+	StatusSkip  CheckStatus = "skip"
+	StatusError CheckStatus = "error" // the check itself could not complete
+)
+
+// Label returns the human readable form used in reports.
+func (s CheckStatus) Label() string {
+	switch s {
+	case StatusPass:
+		return "Passed"
+	case StatusWarn:
+		return "Warning"
+	case StatusFail:
+		return "Failed"
+	case StatusSkip:
+		return "Skipped"
+	case StatusError:
+		return "Error"
+	default:
+		return string(s)
+	}
+}
+
+// Rank orders the statuses by how bad they are; skipped checks rank like passed ones.
+func (s CheckStatus) Rank() int {
+	switch s {
+	case StatusWarn:
+		return 1
+	case StatusFail:
+		return 2
+	case StatusError:
+		return 3
+	default: // pass, skip
+		return 0
+	}
+}
+
+// WorstStatus returns the most severe status among the results; skipped checks count as passed.
+func WorstStatus(results []CheckResult) CheckStatus {
+	worst := StatusPass
+	for _, r := range results {
+		if r.Status.Rank() > worst.Rank() {
+			worst = r.Status
+		}
+	}
+	return worst
+}
+
+// Severity tells how much a non-passing check affects the Kubescape installation.
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+// ObjectRef points at a cluster object (or other entity) that backs a check result.
+type ObjectRef struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Detail    string
+}
+
+// CheckResult is the uniform outcome of a single Checker run.
+type CheckResult struct {
+	Name        string
+	Description string
+	Type        CheckType
+
+	Status   CheckStatus
+	Severity Severity
+	// Reason explains the status in plain words, e.g. why a check failed or was skipped.
+	Reason string
+	// Evidence lists the objects the verdict is based on.
+	Evidence []ObjectRef
+	// Remediation is a hint on how to fix a non-passing check.
+	Remediation string
+	// Details is an optional per-item breakdown, e.g. one row per node or endpoint.
+	Details *ResultTable
+	// RecommendedValues are Helm values for the kubescape-operator chart derived
+	// from the check, keyed by dotted path such as "storage.storageClass".
+	RecommendedValues map[string]string
+}
+
+// ResultTable is a simple table rendered below a check result.
+type ResultTable struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// StatusLabel returns the report form of the status, e.g. "Skipped (requires --active-checks)".
+func (r CheckResult) StatusLabel() string {
+	if r.Status == StatusSkip && r.Reason != "" {
+		return r.Status.Label() + " (" + r.Reason + ")"
+	}
+	return r.Status.Label()
+}
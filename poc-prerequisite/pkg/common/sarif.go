@@ -0,0 +1,188 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	toolName     = "kubescape-prerequisites"
+	toolInfoURI  = "https://github.com/armosec/armo-platform-tools/tree/main/poc-prerequisite"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	Help                 *sarifMessage      `json:"help,omitempty"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+	Properties           sarifRuleProps     `json:"properties"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifRuleProps struct {
+	Tags []string `json:"tags"`
+	// SecuritySeverity is read by GitHub code scanning to rank alerts.
+	SecuritySeverity string `json:"security-severity"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful bool              `json:"executionSuccessful"`
+	EndTimeUTC          string            `json:"endTimeUtc"`
+	Properties          map[string]string `json:"properties"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Kind      string          `json:"kind"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	Kind               string `json:"kind"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+// BuildSARIFReport maps every check to a SARIF rule and one result. Failures and warnings are
+// "fail" results with a level from the severity, passed checks "pass", skipped checks
+// "notApplicable" and checks that could not complete "review".
+// Results are about cluster objects, not files in a repository, so they carry no physical
+// location; the evidence objects are listed as logical locations.
+func BuildSARIFReport(report *ReportData) (string, error) {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           toolName,
+			InformationURI: toolInfoURI,
+			Rules:          []sarifRule{},
+		}},
+		Invocations: []sarifInvocation{{
+			ExecutionSuccessful: true,
+			EndTimeUTC:          report.GeneratedAt.UTC().Format("2006-01-02T15:04:05Z"),
+			Properties: map[string]string{
+				"kubernetesVersion": report.KubernetesVersion,
+				"cloudProvider":     report.CloudProvider,
+				"distribution":      report.K8sDistribution,
+			},
+		}},
+		Results: []sarifResult{},
+	}
+
+	for i, r := range report.CheckResults {
+		rule := sarifRule{
+			ID:                   r.Name,
+			ShortDescription:     sarifMessage{Text: r.Description},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(r.Severity)},
+			Properties: sarifRuleProps{
+				Tags:             []string{"kubescape-prerequisites", string(r.Type)},
+				SecuritySeverity: securitySeverity(r.Severity),
+			},
+		}
+		if r.Remediation != "" {
+			rule.Help = &sarifMessage{Text: r.Remediation}
+		}
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+
+		result := sarifResult{
+			RuleID:    r.Name,
+			RuleIndex: i,
+			Level:     "none",
+			Message:   sarifMessage{Text: fmt.Sprintf("%s: %s", r.Name, r.StatusLabel())},
+		}
+		if text := checkResultText(r); text != "" {
+			result.Message.Text += "\n" + text
+		}
+		switch r.Status {
+		case StatusFail:
+			result.Kind, result.Level = "fail", sarifLevel(r.Severity)
+		case StatusWarn:
+			result.Kind, result.Level = "fail", "warning"
+		case StatusError:
+			result.Kind = "review"
+		case StatusSkip:
+			result.Kind = "notApplicable"
+		default:
+			result.Kind = "pass"
+		}
+		var logical []sarifLogicalLocation
+		for _, e := range r.Evidence {
+			name := e.Kind + "/" + e.Name
+			if e.Namespace != "" {
+				name = e.Kind + "/" + e.Namespace + "/" + e.Name
+			}
+			logical = append(logical, sarifLogicalLocation{Kind: "resource", FullyQualifiedName: name})
+		}
+		if len(logical) > 0 {
+			result.Locations = []sarifLocation{{LogicalLocations: logical}}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	b, err := json.MarshalIndent(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+func sarifLevel(severity Severity) string {
+	switch severity {
+	case SeverityCritical, SeverityHigh:
+		return "error"
+	case SeverityMedium:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+func securitySeverity(severity Severity) string {
+	switch severity {
+	case SeverityCritical:
+		return "9.0"
+	case SeverityHigh:
+		return "7.0"
+	case SeverityMedium:
+		return "5.0"
+	case SeverityLow:
+		return "3.0"
+	default:
+		return "0.0"
+	}
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBuildSARIFReportLocations(t *testing.T) {
+	report := &ReportData{CheckResults: []CheckResult{
+		{Name: "pv-provisioning", Status: StatusPass},
+		{Name: "network-egress", Status: StatusFail, Severity: SeverityHigh,
+			Evidence: []ObjectRef{{Kind: "Endpoint", Name: "api.armosec.io:443"}}},
+	}}
+
+	out, err := BuildSARIFReport(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "physicalLocation") {
+		t.Errorf("SARIF results carry a physical location:\n%s", out)
+	}
+
+	var log struct {
+		Runs []struct {
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Locations []struct {
+					LogicalLocations []struct {
+						FullyQualifiedName string `json:"fullyQualifiedName"`
+					} `json:"logicalLocations"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal([]byte(out), &log); err != nil {
+		t.Fatal(err)
+	}
+	results := log.Runs[0].Results
+	if len(results[0].Locations) != 0 {
+		t.Errorf("%s: locations without evidence: %+v", results[0].RuleID, results[0].Locations)
+	}
+	if got := results[1].Locations[0].LogicalLocations[0].FullyQualifiedName; got != "Endpoint/api.armosec.io:443" {
+		t.Errorf("logical location = %q", got)
+	}
+}
@@ -0,0 +1,242 @@
+package common
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReportServer serves the files of the latest run over HTTP, e.g. through kubectl port-forward:
+//
+//	/              the HTML report (the file index when no HTML report was built)
+//	/files/        the file index, /files/<name> a file such as recommended-values.yaml
+//	/healthz       liveness, always 200 while the server runs
+//	/readyz        200 with the last run once a report exists, 503 before
+//	/run           POST queues a fresh run
+//
+// /run only accepts same-origin requests, and form posts only with the token of the file
+// index, so that a web page opened next to a port-forward cannot trigger runs. Dumps that
+// contain complete objects (dump levels redacted and full) are not served.
+type ReportServer struct {
+	index *template.Template
+	// runToken is embedded in the run form of the file index and required for form posts.
+	runToken string
+
+	mu        sync.RWMutex
+	report    *ReportData
+	artifacts []Artifact
+	lastError string
+
+	triggers chan struct{}
+}
+
+// NewReportServer returns a server without a report; Update publishes one.
+func NewReportServer() *ReportServer {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		log.Fatalf("Could not generate the report server token: %v", err)
+	}
+	return &ReportServer{
+		index:    template.Must(template.New("server-index").Parse(ServerIndexHTML)),
+		runToken: hex.EncodeToString(token),
+		triggers: make(chan struct{}, 1),
+	}
+}
+
+// Update replaces the served report and files with those of a completed run.
+// A dump holding complete objects is left out, as the server has no authentication.
+func (s *ReportServer) Update(report *ReportData, artifacts []Artifact) {
+	served := make([]Artifact, 0, len(artifacts))
+	for _, a := range artifacts {
+		if a.Kind == ArtifactDump && report.DumpLevel.NeedsFullObjects() {
+			continue
+		}
+		served = append(served, a)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report, s.artifacts, s.lastError = report, served, ""
+}
+
+// RunFailed records the error of a run; the previous files, if any, are still served.
+func (s *ReportServer) RunFailed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err.Error()
+}
+
+// Triggers receives a value for every run requested through /run; requests made while
+// one is pending are merged into it.
+func (s *ReportServer) Triggers() <-chan struct{} {
+	return s.triggers
+}
+
+// ListenAndServe serves on addr until ctx is done.
+func (s *ReportServer) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Could not shut down the report server: %v", err)
+		}
+	}()
+
+	log.Printf("Serving the report on http://%s", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Handler returns the routes of the server.
+func (s *ReportServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleRoot)
+	mux.HandleFunc("GET /files/{$}", s.handleIndex)
+	mux.HandleFunc("GET /files/{name}", s.handleFile)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	mux.HandleFunc("POST /run", s.handleRun)
+	return mux
+}
+
+func (s *ReportServer) handleRoot(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	html, ok := s.artifact(HTMLReportFile)
+	s.mu.RUnlock()
+	if !ok {
+		s.handleIndex(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(html.Content))
+}
+
+func (s *ReportServer) handleIndex(w http.ResponseWriter, _ *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := s.index.Execute(w, struct {
+		Report    *ReportData
+		Artifacts []Artifact
+		LastError string
+		RunToken  string
+	}{s.report, s.artifacts, s.lastError, s.runToken})
+	if err != nil {
+		log.Printf("Could not render the file index: %v", err)
+	}
+}
+
+func (s *ReportServer) handleFile(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	a, ok := s.artifact(r.PathValue("name"))
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", contentType(a.FileName))
+	w.Write([]byte(a.Content))
+}
+
+func (s *ReportServer) handleReady(w http.ResponseWriter, _ *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.report == nil {
+		message := "no report yet"
+		if s.lastError != "" {
+			message = "the first run failed: " + s.lastError
+		}
+		http.Error(w, message, http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		LastRun   time.Time `json:"lastRun"`
+		Status    string    `json:"status"`
+		LastError string    `json:"lastError,omitempty"`
+	}{s.report.GeneratedAt, WorstStatus(s.report.CheckResults).Label(), s.lastError})
+}
+
+func (s *ReportServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin run requests are not allowed", http.StatusForbidden)
+		return
+	}
+	form := strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+	if form && subtle.ConstantTimeCompare([]byte(r.PostFormValue("token")), []byte(s.runToken)) != 1 {
+		http.Error(w, "invalid run token, reload the file index", http.StatusForbidden)
+		return
+	}
+
+	message := "run queued"
+	select {
+	case s.triggers <- struct{}{}:
+	default:
+		message = "a run is already queued"
+	}
+	// The button of the file index posts a form; send the browser back to the index
+	if form {
+		http.Redirect(w, r, "/files/", http.StatusSeeOther)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(message + "\n"))
+}
+
+// sameOrigin rejects requests a browser sends on behalf of another site. Browsers set Origin
+// (and Sec-Fetch-Site) on every POST; clients such as curl set neither and are accepted.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && u.Host == r.Host
+}
+
+// artifact returns the served file named name; the caller holds s.mu.
+func (s *ReportServer) artifact(name string) (Artifact, bool) {
+	for _, a := range s.artifacts {
+		if a.FileName == name {
+			return a, true
+		}
+	}
+	return Artifact{}, false
+}
+
+func contentType(fileName string) string {
+	switch path.Ext(fileName) {
+	case ".yaml":
+		return "application/yaml"
+	case ".sarif":
+		return "application/sarif+json"
+	case ".md":
+		return "text/markdown; charset=utf-8"
+	}
+	if t := mime.TypeByExtension(path.Ext(fileName)); t != "" {
+		return t
+	}
+	return "text/plain; charset=utf-8"
+}
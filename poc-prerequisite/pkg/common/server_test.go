@@ -0,0 +1,83 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestReportServerRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		form     url.Values
+		wantCode int
+	}{
+		{name: "curl", wantCode: http.StatusAccepted},
+		{name: "same origin", headers: map[string]string{"Origin": "http://localhost:8080", "Sec-Fetch-Site": "same-origin"}, wantCode: http.StatusAccepted},
+		{name: "cross-site origin", headers: map[string]string{"Origin": "https://evil.example"}, wantCode: http.StatusForbidden},
+		{name: "cross-site fetch", headers: map[string]string{"Sec-Fetch-Site": "cross-site"}, wantCode: http.StatusForbidden},
+		{name: "opaque origin", headers: map[string]string{"Origin": "null"}, wantCode: http.StatusForbidden},
+		{name: "form without token", form: url.Values{}, wantCode: http.StatusForbidden},
+		{name: "form with token", form: url.Values{"token": {"<token>"}}, wantCode: http.StatusSeeOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewReportServer()
+			var req *http.Request
+			if tt.form != nil {
+				if tt.form.Get("token") != "" {
+					tt.form.Set("token", s.runToken)
+				}
+				req = httptest.NewRequest(http.MethodPost, "http://localhost:8080/run", strings.NewReader(tt.form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest(http.MethodPost, "http://localhost:8080/run", nil)
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			queued := len(s.triggers) == 1
+			if wantQueued := tt.wantCode < 400; queued != wantQueued {
+				t.Errorf("run queued = %v, want %v", queued, wantQueued)
+			}
+		})
+	}
+}
+
+func TestReportServerReadyAfterFailedFirstRun(t *testing.T) {
+	s := NewReportServer()
+	s.RunFailed(errors.New("could not write the report files: disk full"))
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "disk full") {
+		t.Errorf("readyz = %d %q, want 503 with the error", rec.Code, rec.Body)
+	}
+}
+
+func TestReportServerOmitsFullDumps(t *testing.T) {
+	artifacts := []Artifact{
+		{Kind: ArtifactValues, FileName: ValuesFile, Content: "a: 1\n"},
+		{Kind: ArtifactDump, FileName: DumpFile, Content: "nodes: []\n"},
+	}
+	for level, wantDump := range map[DumpLevel]bool{DumpLevelSummary: true, DumpLevelRedacted: false, DumpLevelFull: false} {
+		s := NewReportServer()
+		s.Update(&ReportData{DumpLevel: level}, artifacts)
+
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/"+DumpFile, nil))
+		if served := rec.Code == http.StatusOK; served != wantDump {
+			t.Errorf("level %s: dump served = %v, want %v", level, served, wantDump)
+		}
+	}
+}
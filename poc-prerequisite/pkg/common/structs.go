@@ -1,6 +1,9 @@
 package common
 
 import (
+	"sort"
+	"time"
+
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -19,42 +22,94 @@ type SizingResult struct {
 
 	// Whether any resource changed from default
 	HasAnyAdjustments bool
+
+	// AccuracyNotes explain which recommendations are unreliable because data is missing.
+	AccuracyNotes []string
 }
 
 type NodeInfoSummary struct {
-	OperatingSystemCounts         map[string]int
-	ArchitectureCounts            map[string]int
-	KernelVersionCounts           map[string]int
-	OSImageCounts                 map[string]int
-	ContainerRuntimeVersionCounts map[string]int
-	KubeletVersionCounts          map[string]int
-	KubeProxyVersionCounts        map[string]int
+	OperatingSystemCounts         map[string]int `json:"operatingSystemCounts"`
+	ArchitectureCounts            map[string]int `json:"architectureCounts"`
+	KernelVersionCounts           map[string]int `json:"kernelVersionCounts"`
+	OSImageCounts                 map[string]int `json:"osImageCounts"`
+	ContainerRuntimeVersionCounts map[string]int `json:"containerRuntimeVersionCounts"`
+	KubeletVersionCounts          map[string]int `json:"kubeletVersionCounts"`
+	KubeProxyVersionCounts        map[string]int `json:"kubeProxyVersionCounts"`
 }
 
 // ClusterDetails stores metadata about the cluster
 type ClusterDetails struct {
-	Name            string
-	Version         string
-	CloudProvider   string
-	K8sDistribution string
-	TotalNodeCount  int
-	TotalVCPUCount  int
+	Name            string `json:"name"`
+	Version         string `json:"version"`
+	CloudProvider   string `json:"cloudProvider"`
+	K8sDistribution string `json:"k8sDistribution"`
+	TotalNodeCount  int    `json:"totalNodeCount"`
+	TotalVCPUCount  int    `json:"totalVCPUCount"`
 }
 
 // ClusterData aggregates everything we collect from the cluster.
+// It is written as full-cluster-dump.yaml and can be loaded back with LoadClusterData.
 type ClusterData struct {
-	Nodes        []corev1.Node
-	Pods         []corev1.Pod
-	Services     []corev1.Service
-	Deployments  []appsv1.Deployment
-	ReplicaSets  []appsv1.ReplicaSet
-	StatefulSets []appsv1.StatefulSet
-	DaemonSets   []appsv1.DaemonSet
-	Jobs         []batchv1.Job
-	CronJobs     []batchv1.CronJob
-
-	ClusterDetails    ClusterDetails
-	NodeInfoSummaries NodeInfoSummary
+	// DumpFormat is set to DumpFormatVersion when the data is written as a dump,
+	// so that LoadClusterData can reject dumps it does not understand.
+	DumpFormat string `json:"dumpFormat,omitempty"`
+
+	Nodes        []corev1.Node        `json:"nodes"`
+	Pods         []corev1.Pod         `json:"pods"`
+	Services     []corev1.Service     `json:"services"`
+	Deployments  []appsv1.Deployment  `json:"deployments"`
+	ReplicaSets  []appsv1.ReplicaSet  `json:"replicasets"`
+	StatefulSets []appsv1.StatefulSet `json:"statefulsets"`
+	DaemonSets   []appsv1.DaemonSet   `json:"daemonsets"`
+	Jobs         []batchv1.Job        `json:"jobs"`
+	CronJobs     []batchv1.CronJob    `json:"cronjobs"`
+
+	ClusterDetails    ClusterDetails  `json:"clusterDetails"`
+	NodeInfoSummaries NodeInfoSummary `json:"nodeInfoSummaries"`
+
+	// MetadataOnly is set when only nodes were collected as full objects;
+	// the other kinds are then only counted in ResourceCounts.
+	MetadataOnly bool `json:"metadataOnly,omitempty"`
+	// ResourceCounts holds the number of objects per collected kind, e.g. "pods".
+	ResourceCounts map[string]int `json:"resourceCounts,omitempty"`
+
+	// CollectionStats holds per-kind timing of the collection, in collection order.
+	CollectionStats    []CollectionStat `json:"collectionStats,omitempty"`
+	CollectionDuration time.Duration    `json:"collectionDuration,omitempty"`
+	// CollectionErrors maps every kind that could not be collected (or "version") to its error.
+	// The matching fields of ClusterData are empty or incomplete.
+	CollectionErrors map[string]string `json:"collectionErrors,omitempty"`
+
+	// DumpLevel records how the data was reduced when it was written as a dump.
+	DumpLevel DumpLevel `json:"dumpLevel,omitempty"`
+
+	// Source describes where the data came from when it was not collected live, e.g. a dump file.
+	Source string `json:"-"`
+}
+
+// MissingKinds returns the sorted kinds that failed to collect.
+func (cd *ClusterData) MissingKinds() []string {
+	kinds := make([]string, 0, len(cd.CollectionErrors))
+	for kind := range cd.CollectionErrors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// MissingData is a kind that could not be collected.
+type MissingData struct {
+	Kind  string
+	Error string
+}
+
+// CollectionStat describes how listing one resource kind went.
+type CollectionStat struct {
+	Kind     string        `json:"kind"`
+	Count    int           `json:"count"`
+	Pages    int           `json:"pages"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
 }
 
 type ReportData struct {
@@ -72,8 +127,17 @@ type ReportData struct {
 	TotalNodeCount    int
 	TotalVCPUCount    int
 
+	// ClusterName is the kubeconfig context (or dump file) the report was generated for.
+	ClusterName string
+
 	GenerationTime    string
+	GeneratedAt       time.Time
 	HasAnyAdjustments bool
+	// DataSource is set when the report was built from a dump instead of a live cluster.
+	DataSource string
+	// DumpLevel and RedactionRules describe the full-cluster-dump.yaml written next to the report.
+	DumpLevel      DumpLevel
+	RedactionRules []string
 
 	NodeOSSummary               string
 	NodeArchSummary             string
@@ -85,5 +149,14 @@ type ReportData struct {
 
 	FullClusterData *ClusterData
 
-	PVProvisioningMessage string
+	CollectionStats    []CollectionStat
+	CollectionDuration string
+	// MissingData lists the kinds that could not be collected, with their error.
+	MissingData []MissingData
+	// SizingAccuracyNotes explain how the missing data affects the recommendations.
+	SizingAccuracyNotes []string
+
+	CheckResults []CheckResult
+	// RecommendedValues merges the Helm values recommended by all checks.
+	RecommendedValues map[string]string
 }
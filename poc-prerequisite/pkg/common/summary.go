@@ -0,0 +1,151 @@
+package common
+
+import (
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClusterRun is the outcome of checking one cluster in a multi-cluster run.
+type ClusterRun struct {
+	Context string
+	// Report is nil when the cluster could not be checked at all.
+	Report *ReportData
+	// Error explains why the cluster could not be checked.
+	Error string
+	// ReportPath is the per-cluster HTML report, relative to the summary.
+	ReportPath string
+	Duration   time.Duration
+}
+
+// ClustersSummary compares several clusters side by side: one column per cluster, one row per property.
+type ClustersSummary struct {
+	GenerationTime string
+	Clusters       []ClusterRun
+	Rows           []ClustersSummaryRow
+}
+
+type ClustersSummaryRow struct {
+	Label string
+	// Section rows only carry a Label and start a new group of rows.
+	Section bool
+	Cells   []ClustersSummaryCell
+}
+
+type ClustersSummaryCell struct {
+	Text string
+	// Status colors the cell; empty for plain values.
+	Status CheckStatus
+}
+
+// BuildClustersSummary lays out the cluster runs for the summary report.
+// Checks are listed in the order they first appear across clusters.
+func BuildClustersSummary(runs []ClusterRun) *ClustersSummary {
+	summary := &ClustersSummary{
+		GenerationTime: time.Now().Format("2006-01-02 15:04:05"),
+		Clusters:       runs,
+	}
+
+	row := func(label string, value func(r *ReportData) string) {
+		cells := make([]ClustersSummaryCell, len(runs))
+		for i, run := range runs {
+			if run.Report != nil {
+				cells[i].Text = value(run.Report)
+			}
+		}
+		summary.Rows = append(summary.Rows, ClustersSummaryRow{Label: label, Cells: cells})
+	}
+	section := func(label string) {
+		summary.Rows = append(summary.Rows, ClustersSummaryRow{Label: label, Section: true})
+	}
+
+	// Run status, also shown for clusters that could not be checked
+	statusCells := make([]ClustersSummaryCell, len(runs))
+	durationCells := make([]ClustersSummaryCell, len(runs))
+	for i, run := range runs {
+		switch {
+		case run.Report == nil:
+			statusCells[i] = ClustersSummaryCell{Text: "Not checked: " + run.Error, Status: StatusError}
+		case len(run.Report.MissingData) > 0:
+			statusCells[i] = ClustersSummaryCell{Text: "Partial data", Status: StatusWarn}
+		default:
+			statusCells[i] = ClustersSummaryCell{Text: "Checked", Status: StatusPass}
+		}
+		durationCells[i].Text = run.Duration.Round(time.Second).String()
+	}
+	summary.Rows = append(summary.Rows,
+		ClustersSummaryRow{Label: "Run", Cells: statusCells},
+		ClustersSummaryRow{Label: "Duration", Cells: durationCells},
+	)
+
+	section("Cluster Details")
+	row("K8s Version", func(r *ReportData) string { return r.KubernetesVersion })
+	row("Cloud Provider", func(r *ReportData) string { return r.CloudProvider })
+	row("K8s Distribution", func(r *ReportData) string { return r.K8sDistribution })
+	row("Total Nodes", func(r *ReportData) string { return strconv.Itoa(r.TotalNodeCount) })
+	row("Total vCPUs", func(r *ReportData) string { return strconv.Itoa(r.TotalVCPUCount) })
+	row("Node Architecture", func(r *ReportData) string { return r.NodeArchSummary })
+
+	section("Sizing")
+	row("Total Resources", func(r *ReportData) string { return strconv.Itoa(r.TotalResources) })
+	row("Max Node CPU (m)", func(r *ReportData) string { return strconv.Itoa(r.MaxNodeCPUCapacity) })
+	row("Max Node Memory (MB)", func(r *ReportData) string { return strconv.Itoa(r.MaxNodeMemoryMB) })
+	row("Largest Image (MB)", func(r *ReportData) string { return strconv.Itoa(r.LargestContainerImageMB) })
+	row("Adjustments Needed", func(r *ReportData) string {
+		if r.HasAnyAdjustments {
+			return "Yes"
+		}
+		return "No"
+	})
+	for _, comp := range []string{"nodeAgent", "storage", "kubevuln"} {
+		row(comp+" memory", func(r *ReportData) string {
+			alloc := r.FinalResourceAllocations[comp]
+			return fmt.Sprintf("%s / %s", alloc["memReq"], alloc["memLim"])
+		})
+	}
+
+	section("Prerequisite Checks")
+	var checkNames []string
+	seen := map[string]bool{}
+	for _, run := range runs {
+		if run.Report == nil {
+			continue
+		}
+		for _, r := range run.Report.CheckResults {
+			if !seen[r.Name] {
+				seen[r.Name] = true
+				checkNames = append(checkNames, r.Name)
+			}
+		}
+	}
+	for _, name := range checkNames {
+		cells := make([]ClustersSummaryCell, len(runs))
+		for i, run := range runs {
+			if run.Report == nil {
+				continue
+			}
+			for _, r := range run.Report.CheckResults {
+				if r.Name == name {
+					cells[i] = ClustersSummaryCell{Text: r.StatusLabel(), Status: r.Status}
+				}
+			}
+		}
+		summary.Rows = append(summary.Rows, ClustersSummaryRow{Label: name, Cells: cells})
+	}
+
+	return summary
+}
+
+func BuildClustersSummaryHTML(summary *ClustersSummary, tpl string) string {
+	tmpl, err := template.New("clusters-summary").Parse(tpl)
+	if err != nil {
+		return fmt.Sprintf("Error building summary: %v", err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, summary); err != nil {
+		return fmt.Sprintf("Error executing summary template: %v", err)
+	}
+	return sb.String()
+}
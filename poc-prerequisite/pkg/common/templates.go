@@ -6,3 +6,9 @@ import (
 
 //go:embed templates/prerequisites-report.html
 var PrerequisitesReportHTML string
+
+//go:embed templates/clusters-summary.html
+var ClustersSummaryHTML string
+
+//go:embed templates/server-index.html
+var ServerIndexHTML string
@@ -0,0 +1,264 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ANSI escape codes of the terminal summary.
+const (
+	ansiReset  = "\033[0m"
+	ansiBold   = "\033[1m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+)
+
+// ColorSupported reports whether w, the writer the summary goes to, is a terminal
+// and colors were not disabled via NO_COLOR.
+func ColorSupported(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func statusColor(status CheckStatus) string {
+	switch status {
+	case StatusPass:
+		return ansiGreen
+	case StatusWarn, StatusSkip:
+		return ansiYellow
+	default:
+		return ansiRed
+	}
+}
+
+func statusIcon(status CheckStatus) string {
+	switch status {
+	case StatusPass:
+		return "✅"
+	case StatusWarn, StatusSkip:
+		return "⚠️ "
+	default:
+		return "❌"
+	}
+}
+
+// overrideRow is a Helm value that differs from the chart default.
+type overrideRow struct {
+	Key         string
+	Default     string
+	Recommended string
+}
+
+var allocationFields = []struct{ field, path string }{
+	{"cpuReq", "resources.requests.cpu"},
+	{"memReq", "resources.requests.memory"},
+	{"cpuLim", "resources.limits.cpu"},
+	{"memLim", "resources.limits.memory"},
+}
+
+// overrideRows lists the resource overrides of recommended-values.yaml, then the values recommended by checks.
+func overrideRows(report *ReportData) []overrideRow {
+	var rows []overrideRow
+	for _, comp := range []string{"nodeAgent", "storage", "kubevuln"} {
+		defaults, finals := report.DefaultResourceAllocations[comp], report.FinalResourceAllocations[comp]
+		for _, f := range allocationFields {
+			def, okDef := defaults[f.field]
+			final, ok := finals[f.field]
+			if ok && okDef && def != final {
+				rows = append(rows, overrideRow{Key: comp + "." + f.path, Default: def, Recommended: final})
+			}
+		}
+	}
+	keys := make([]string, 0, len(report.RecommendedValues))
+	for key := range report.RecommendedValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		rows = append(rows, overrideRow{Key: key, Default: "chart default", Recommended: report.RecommendedValues[key]})
+	}
+	return rows
+}
+
+func sizingInputRows(report *ReportData) [][]string {
+	return [][]string{
+		{"Kubernetes version", report.KubernetesVersion},
+		{"Cloud provider / distribution", report.CloudProvider + " / " + report.K8sDistribution},
+		{"Nodes / vCPUs", strconv.Itoa(report.TotalNodeCount) + " / " + strconv.Itoa(report.TotalVCPUCount)},
+		{"Total resources", strconv.Itoa(report.TotalResources)},
+		{"Max node CPU", strconv.Itoa(report.MaxNodeCPUCapacity) + "m"},
+		{"Max node memory", strconv.Itoa(report.MaxNodeMemoryMB) + " MB"},
+		{"Largest container image", strconv.Itoa(report.LargestContainerImageMB) + " MB"},
+	}
+}
+
+// writeTable prints an aligned table; colorOf, when not nil, returns the color of a cell.
+func writeTable(w io.Writer, header []string, rows [][]string, colorOf func(row, col int) string) {
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = len([]rune(h))
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := len([]rune(cell)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	line := func(cells []string, color func(col int) string) {
+		var sb strings.Builder
+		sb.WriteString("   ")
+		for i, cell := range cells {
+			padded := cell
+			if i < len(cells)-1 {
+				padded += strings.Repeat(" ", widths[i]-len([]rune(cell))+2)
+			}
+			if c := color(i); c != "" {
+				padded = c + padded + ansiReset
+			}
+			sb.WriteString(padded)
+		}
+		fmt.Fprintln(w, strings.TrimRight(sb.String(), " "))
+	}
+
+	line(header, func(int) string {
+		if colorOf != nil {
+			return ansiBold
+		}
+		return ""
+	})
+	for r, row := range rows {
+		line(row, func(col int) string {
+			if colorOf == nil {
+				return ""
+			}
+			return colorOf(r, col)
+		})
+	}
+}
+
+// printSummary prints the check statuses, sizing inputs and recommended overrides.
+func printSummary(w io.Writer, report *ReportData, color bool) {
+	printMissingData(report)
+
+	printSeparator()
+	fmt.Fprintln(w, "🔎 Prerequisite checks:")
+	var rows [][]string
+	for _, r := range report.CheckResults {
+		rows = append(rows, []string{r.Name, string(r.Type), r.StatusLabel()})
+	}
+	var colorOf func(row, col int) string
+	if color {
+		colorOf = func(row, col int) string {
+			if col == 2 {
+				return statusColor(report.CheckResults[row].Status)
+			}
+			return ""
+		}
+	}
+	writeTable(w, []string{"CHECK", "TYPE", "STATUS"}, rows, colorOf)
+	for _, r := range report.CheckResults {
+		if r.Status == StatusPass || r.Status == StatusSkip {
+			continue
+		}
+		fmt.Fprintf(w, "\n   %s %s\n", statusIcon(r.Status), r.Name)
+		if r.Reason != "" {
+			fmt.Fprintln(w, "      Reason:", r.Reason)
+		}
+		if r.Remediation != "" {
+			fmt.Fprintln(w, "      Remediation:", r.Remediation)
+		}
+	}
+
+	printSeparator()
+	fmt.Fprintln(w, "📐 Sizing inputs:")
+	writeTable(w, []string{"INPUT", "VALUE"}, sizingInputRows(report), nil)
+
+	printSeparator()
+	fmt.Fprintln(w, "🛠  Recommended overrides:")
+	overrides := overrideRows(report)
+	if len(overrides) == 0 {
+		fmt.Fprintln(w, "   None, the default values fit this cluster.")
+		return
+	}
+	rows = rows[:0]
+	for _, o := range overrides {
+		rows = append(rows, []string{o.Key, o.Default, o.Recommended})
+	}
+	colorOf = nil
+	if color {
+		colorOf = func(_, col int) string {
+			if col == 2 {
+				return ansiBold
+			}
+			return ""
+		}
+	}
+	writeTable(w, []string{"VALUE", "DEFAULT", "RECOMMENDED"}, rows, colorOf)
+}
+
+// BuildMarkdownSummary renders the same summary as Markdown, to paste into a ticket or pull request.
+func BuildMarkdownSummary(report *ReportData) string {
+	var sb strings.Builder
+	cell := func(s string) string {
+		return strings.ReplaceAll(strings.ReplaceAll(s, "|", "\\|"), "\n", " ")
+	}
+
+	sb.WriteString("## Kubescape prerequisites summary\n\n")
+	sb.WriteString("Generated on " + report.GenerationTime)
+	if report.DataSource != "" {
+		sb.WriteString(" from `" + report.DataSource + "`")
+	}
+	sb.WriteString(".\n\n")
+
+	if len(report.MissingData) > 0 {
+		sb.WriteString("> **Some cluster data could not be collected:**\n")
+		for _, m := range report.MissingData {
+			sb.WriteString("> - `" + m.Kind + "`: " + cell(m.Error) + "\n")
+		}
+		for _, note := range report.SizingAccuracyNotes {
+			sb.WriteString("> - " + note + "\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("### Checks\n\n| Check | Type | Status | Reason | Remediation |\n|---|---|---|---|---|\n")
+	for _, r := range report.CheckResults {
+		reason, remediation := r.Reason, r.Remediation
+		if r.Status == StatusPass || r.Status == StatusSkip {
+			reason, remediation = "", ""
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %s %s | %s | %s |\n",
+			r.Name, r.Type, statusIcon(r.Status), r.StatusLabel(), cell(reason), cell(remediation))
+	}
+
+	sb.WriteString("\n### Sizing inputs\n\n| Input | Value |\n|---|---|\n")
+	for _, row := range sizingInputRows(report) {
+		fmt.Fprintf(&sb, "| %s | %s |\n", row[0], cell(row[1]))
+	}
+
+	sb.WriteString("\n### Recommended overrides\n\n")
+	overrides := overrideRows(report)
+	if len(overrides) == 0 {
+		sb.WriteString("None, the default values fit this cluster.\n")
+		return sb.String()
+	}
+	sb.WriteString("| Value | Default | Recommended |\n|---|---|---|\n")
+	for _, o := range overrides {
+		fmt.Fprintf(&sb, "| `%s` | %s | **%s** |\n", o.Key, cell(o.Default), cell(o.Recommended))
+	}
+	return sb.String()
+}
@@ -0,0 +1,200 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// InformerNotSyncedError prefixes the CollectionErrors of kinds whose informer cache was not
+// synced when a snapshot was taken; their counts are then incomplete.
+const InformerNotSyncedError = "informer cache not synced"
+
+// ClusterWatcher keeps the data of CollectClusterData up to date with shared informers instead
+// of listing the cluster on every run: nodes are cached as full objects, the workload kinds
+// through metadata informers, which keep only the object metadata in memory.
+type ClusterWatcher struct {
+	clientset   *kubernetes.Clientset
+	callTimeout time.Duration
+
+	factory     informers.SharedInformerFactory
+	metaFactory metadatainformer.SharedInformerFactory
+	nodes       cache.SharedIndexInformer
+	workloads   map[string]cache.SharedIndexInformer
+
+	changes chan string
+
+	mu         sync.Mutex
+	syncErrors map[string]string
+}
+
+// NewClusterWatcher creates the informers; resync is the informer resync period (0 disables it).
+func NewClusterWatcher(clientset *kubernetes.Clientset, metadataClient metadata.Interface, resync, callTimeout time.Duration) *ClusterWatcher {
+	if callTimeout <= 0 {
+		callTimeout = DefaultCallTimeout
+	}
+	w := &ClusterWatcher{
+		clientset:   clientset,
+		callTimeout: callTimeout,
+		factory:     informers.NewSharedInformerFactory(clientset, resync),
+		metaFactory: metadatainformer.NewSharedInformerFactory(metadataClient, resync),
+		workloads:   map[string]cache.SharedIndexInformer{},
+		changes:     make(chan string, 1),
+		syncErrors:  map[string]string{},
+	}
+
+	w.nodes = w.factory.Core().V1().Nodes().Informer()
+	w.watchErrors("nodes", w.nodes)
+	w.nodes.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(_ interface{}, isInInitialList bool) {
+			if !isInInitialList {
+				w.notify("nodes")
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, ok1 := oldObj.(*corev1.Node)
+			newNode, ok2 := newObj.(*corev1.Node)
+			if ok1 && ok2 && nodeChanged(oldNode, newNode) {
+				w.notify("nodes")
+			}
+		},
+		DeleteFunc: func(interface{}) { w.notify("nodes") },
+	})
+
+	for kind, gvr := range workloadResources {
+		informer := w.metaFactory.ForResource(gvr).Informer()
+		w.watchErrors(kind, informer)
+		// Only additions and deletions change the sizing; updates (e.g. pod status) do not
+		informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+			AddFunc: func(_ interface{}, isInInitialList bool) {
+				if !isInInitialList {
+					w.notify(kind)
+				}
+			},
+			DeleteFunc: func(interface{}) { w.notify(kind) },
+		})
+		w.workloads[kind] = informer
+	}
+	return w
+}
+
+// nodeChanged tells whether an update touches what sizing or the node checks look at,
+// ignoring the heartbeats and conditions that change all the time.
+func nodeChanged(oldNode, newNode *corev1.Node) bool {
+	return oldNode.Status.NodeInfo != newNode.Status.NodeInfo ||
+		!reflect.DeepEqual(oldNode.Status.Capacity, newNode.Status.Capacity) ||
+		!reflect.DeepEqual(oldNode.Labels, newNode.Labels) ||
+		!reflect.DeepEqual(oldNode.Spec.Taints, newNode.Spec.Taints)
+}
+
+func (w *ClusterWatcher) watchErrors(kind string, informer cache.SharedIndexInformer) {
+	if err := informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		w.mu.Lock()
+		w.syncErrors[kind] = err.Error()
+		w.mu.Unlock()
+	}); err != nil {
+		log.Printf("Could not watch the errors of the %s informer: %v", kind, err)
+	}
+}
+
+// notify signals a change without blocking; changes that arrive while one is pending are merged.
+func (w *ClusterWatcher) notify(kind string) {
+	select {
+	case w.changes <- kind:
+	default:
+	}
+}
+
+// Changes receives the kind of a relevant change, e.g. "nodes" when a node was added.
+func (w *ClusterWatcher) Changes() <-chan string {
+	return w.changes
+}
+
+// Start runs the informers until ctx is done and waits, at most syncTimeout, for their caches.
+// Kinds that did not sync, e.g. because RBAC forbids listing them, are reported as missing
+// by Snapshot until they do.
+func (w *ClusterWatcher) Start(ctx context.Context, syncTimeout time.Duration) {
+	w.factory.Start(ctx.Done())
+	w.metaFactory.Start(ctx.Done())
+
+	syncCtx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+	for kind, informer := range w.informers() {
+		if !cache.WaitForCacheSync(syncCtx.Done(), informer.HasSynced) {
+			log.Printf("The %s informer did not sync within %s", kind, syncTimeout)
+		}
+	}
+}
+
+func (w *ClusterWatcher) informers() map[string]cache.SharedIndexInformer {
+	all := map[string]cache.SharedIndexInformer{"nodes": w.nodes}
+	for kind, informer := range w.workloads {
+		all[kind] = informer
+	}
+	return all
+}
+
+// Snapshot builds ClusterData from the informer caches, like CollectClusterData in MetadataOnly mode.
+func (w *ClusterWatcher) Snapshot(ctx context.Context) *ClusterData {
+	start := time.Now()
+	cd := &ClusterData{
+		MetadataOnly:     true,
+		ResourceCounts:   map[string]int{},
+		CollectionErrors: map[string]string{},
+	}
+
+	if kubeVersion, err := ServerVersion(ctx, w.clientset, w.callTimeout); err != nil {
+		cd.CollectionErrors["version"] = err.Error()
+		cd.ClusterDetails.Version = "unknown"
+	} else {
+		cd.ClusterDetails.Version = kubeVersion.String()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	informers := w.informers()
+	kinds := make([]string, 0, len(informers))
+	for kind := range informers {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		informer := informers[kind]
+		stat := CollectionStat{Kind: kind}
+		if !informer.HasSynced() {
+			stat.Error = InformerNotSyncedError
+			if err, ok := w.syncErrors[kind]; ok {
+				stat.Error = fmt.Sprintf("%s: %s", InformerNotSyncedError, err)
+			}
+			cd.CollectionErrors[kind] = stat.Error
+		}
+		items := informer.GetStore().List()
+		stat.Count = len(items)
+		if kind == "nodes" {
+			for _, item := range items {
+				if node, ok := item.(*corev1.Node); ok {
+					cd.Nodes = append(cd.Nodes, *node)
+				}
+			}
+		}
+		cd.ResourceCounts[kind] = stat.Count
+		cd.CollectionStats = append(cd.CollectionStats, stat)
+	}
+
+	// The store is unordered; List calls return the nodes by name
+	sort.Slice(cd.Nodes, func(i, j int) bool { return cd.Nodes[i].Name < cd.Nodes[j].Name })
+	summarizeNodes(cd)
+	cd.CollectionDuration = time.Since(start)
+	return cd
+}